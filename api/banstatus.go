@@ -0,0 +1,18 @@
+package api
+
+import "time"
+
+// MaxBanStatusBatch is the most IPs one /api/v1/ban-status/batch request
+// may ask about.
+const MaxBanStatusBatch = 1000
+
+// BanStatus reports whether an IP is banned and for how much longer.
+type BanStatus struct {
+	Banned    bool       `json:"banned"`
+	IP        string     `json:"ip"`
+	Reason    string     `json:"reason,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil for permanent bans
+	// SecondsRemaining is the time left on the ban, rounded up; -1 for a
+	// permanent ban and 0 when not banned.
+	SecondsRemaining int `json:"seconds_remaining"`
+}
@@ -0,0 +1,8 @@
+package api
+
+// BlockedPage is the data blocked-page templates are executed with.
+type BlockedPage struct {
+	Decision
+	Status int    // HTTP status of the response
+	Title  string // status text, e.g. "Forbidden"
+}
@@ -0,0 +1,30 @@
+package api
+
+// ServerConfig summarizes the server's limits and modes so clients can
+// adapt their own throttling. It never carries secrets. Durations are whole
+// seconds.
+type ServerConfig struct {
+	RequestLimit         int    `json:"request_limit"`
+	RequestWindowSeconds int    `json:"request_window_seconds"`
+	BurstGrace           int    `json:"burst_grace"`
+	RateLimitKey         string `json:"rate_limit_key"`
+
+	Escalation            string `json:"escalation"`
+	ThrottleLimit         int    `json:"throttle_limit"`
+	ThrottleWindowSeconds int    `json:"throttle_window_seconds"`
+	BanDurationSeconds    int    `json:"ban_duration_seconds"`
+	RetryAfterFormat      string `json:"retry_after_format"`
+	FlagStatusCode        int    `json:"flag_status_code"`
+
+	ErrorStatusLimit          int      `json:"error_status_limit"`
+	ErrorStatusWindowSeconds  int      `json:"error_status_window_seconds"`
+	DistinctPathThreshold     int      `json:"distinct_path_threshold"`
+	DistinctPathWindowSeconds int      `json:"distinct_path_window_seconds"`
+	BannedMethods             []string `json:"banned_methods"`
+	UncountedMethods          []string `json:"uncounted_methods"`
+
+	MaxConcurrentPerIP        int   `json:"max_concurrent_per_ip"`
+	MaxBodyBytes              int64 `json:"max_body_bytes"`
+	StartupGracePeriodSeconds int   `json:"startup_grace_period_seconds"`
+	Lockdown                  bool  `json:"lockdown"`
+}
@@ -0,0 +1,25 @@
+// Package api holds the wire types shared by the Tower server and the Go SDK,
+// so both sides serialize exactly the same shapes.
+package api
+
+// Action is the escalation level Tower assigns to an IP.
+type Action string
+
+const (
+	ActionAllow    Action = "ALLOW"
+	ActionFlag     Action = "FLAG"
+	ActionThrottle Action = "THROTTLE"
+	ActionBan      Action = "BAN"
+	// ActionUnban is only sent to callbacks, when a ban is lifted or expires.
+	ActionUnban Action = "UNBAN"
+)
+
+// Decision is the result of inspecting or logging a request.
+type Decision struct {
+	Action     Action `json:"action"`
+	IP         string `json:"ip"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"` // seconds
+	// Code identifies the rule behind some decisions, e.g. UA_BLOCKED.
+	Code string `json:"code,omitempty"`
+}
@@ -0,0 +1,17 @@
+package api
+
+import "time"
+
+// DecisionEvent describes one decision as written to the decision log and
+// streamed by /api/v1/admin/events.
+type DecisionEvent struct {
+	TS     time.Time `json:"ts"`
+	Action Action    `json:"action"`
+	IP     string    `json:"ip"`
+	Tenant string    `json:"tenant,omitempty"`
+	Method string    `json:"method,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Code   string    `json:"code,omitempty"`    // rule behind the decision, as in Decision.Code
+	UserID string    `json:"user_id,omitempty"` // application user the request was logged for
+}
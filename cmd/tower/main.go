@@ -2,19 +2,27 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"tower/internal/config"
 	"tower/internal/db"
 	"tower/internal/httpapi"
 	"tower/internal/logic"
+	"tower/sdk/go/tower"
 )
 
 func main() {
@@ -34,6 +42,28 @@ func main() {
 		unbanIPCmd(os.Args[2:])
 	case "list-bans":
 		listBansCmd(os.Args[2:])
+	case "soft-list-ip":
+		softListIPCmd(os.Args[2:])
+	case "note-ip":
+		noteIPCmd(os.Args[2:])
+	case "set-admin-password":
+		setAdminPasswordCmd(os.Args[2:])
+	case "generate-config":
+		generateConfigCmd(os.Args[2:])
+	case "lockdown":
+		lockdownCmd(os.Args[2:])
+	case "simulate":
+		simulateCmd(os.Args[2:])
+	case "ui-link":
+		uiLinkCmd(os.Args[2:])
+	case "fsck":
+		fsckCmd(os.Args[2:])
+	case "report":
+		reportCmd(os.Args[2:])
+	case "tail":
+		tailCmd(os.Args[2:])
+	case "quickstart":
+		quickstartCmd(os.Args[2:])
 	default:
 		usage()
 		os.Exit(1)
@@ -48,7 +78,18 @@ Commands:
   status        Display system status and metrics
   ban-ip        Ban an IP manually
   unban-ip      Remove IP ban
-  list-bans     List banned IPs`)
+  list-bans     List banned IPs
+  soft-list-ip  Cap an IP/CIDR at THROTTLE so it is never banned (--remove to undo)
+  note-ip       Attach an operator note to an IP (--list to show its notes)
+  set-admin-password  Set the admin password for /ui/login
+  generate-config     Write the default config to a JSON file for serve --config
+  lockdown      Deny all non-allowlisted traffic: lockdown on|off
+  simulate      Replay an access log through the limiter and report decisions
+  ui-link       Print a signed admin link that expires after --ttl
+  fsck          Check database integrity and stale bans (--fix to delete them)
+  report        Count FLAG/THROTTLE/BAN decisions over the last --since
+  tail          Stream live decisions from a running server (--filter BAN,THROTTLE)
+  quickstart    Print the API key with ready-to-paste Go SDK and curl examples`)
 }
 
 func commonFlags(fs *flag.FlagSet) *string {
@@ -56,9 +97,16 @@ func commonFlags(fs *flag.FlagSet) *string {
 	return dataDir
 }
 
+// tenantFlag registers the --tenant flag used by ban management commands.
+func tenantFlag(fs *flag.FlagSet) *string {
+	return fs.String("tenant", "", "tenant id (empty for the default tenant)")
+}
+
 func openDB(dataDir string) *db.DB {
-	if err := os.MkdirAll(dataDir, 0o755); err != nil {
-		log.Fatalf("create data dir: %v", err)
+	if dataDir != db.MemoryDataDir {
+		if err := os.MkdirAll(dataDir, 0o755); err != nil {
+			log.Fatalf("create data dir: %v", err)
+		}
 	}
 	d, err := db.Open(dataDir)
 	if err != nil {
@@ -83,45 +131,181 @@ func ensureAdminToken(d *db.DB) (string, error) {
 	return tok, nil
 }
 
+// readAdminToken returns the admin token stored in an existing database in
+// dataDir. Unlike openDB and ensureAdminToken it creates nothing, so a
+// mistyped --data-dir is an error rather than a fresh token the server
+// would reject.
+func readAdminToken(dataDir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dataDir, "tower.db")); err != nil {
+		return "", fmt.Errorf("no tower database in %s (pass --key or the server's --data-dir): %w", dataDir, err)
+	}
+	d := openDB(dataDir)
+	defer d.Close()
+	tok, ok, err := d.GetSetting("admin_token")
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("no admin token in %s; start serve once or pass --key", dataDir)
+	}
+	return tok, nil
+}
+
 func serveCmd(args []string) {
 	fs := flag.NewFlagSet("serve", flag.ExitOnError)
 	dataDir := commonFlags(fs)
+	inMemory := fs.Bool("in-memory", false, "keep all state in memory (same as --data-dir :memory:)")
+	configPath := fs.String("config", "", "JSON config file (see generate-config); flags override it")
 	addr := fs.String("addr", ":8080", "listen address")
+	basePath := fs.String("base-path", "", "path prefix for every route, e.g. /tower behind a reverse proxy")
+	blocklist := fs.String("blocklist-url", "", "URL of a newline-separated IP/CIDR blocklist to import as bans")
+	defaults := config.DefaultConfig()
+	readHeaderTimeout := fs.Duration("read-header-timeout", defaults.ReadHeaderTimeout, "max time to read request headers")
+	readTimeout := fs.Duration("read-timeout", defaults.ReadTimeout, "max time to read an entire request")
+	writeTimeout := fs.Duration("write-timeout", defaults.WriteTimeout, "max time to write a response")
+	idleTimeout := fs.Duration("idle-timeout", defaults.IdleTimeout, "max keep-alive idle time")
+	bodyReadTimeout := fs.Duration("body-read-timeout", defaults.BodyReadTimeout, "max time to read an API request body (0 disables)")
+	errorStatusLimit := fs.Int("error-status-limit", 0, "4xx responses per IP within the error window before escalating (0 disables)")
+	distinctPathThreshold := fs.Int("distinct-path-threshold", 0, "distinct paths per IP within the path window before flagging it as a scanner (0 disables)")
+	bannedMethods := fs.String("banned-methods", "", "comma-separated HTTP methods that are banned outright (e.g. TRACE,CONNECT)")
+	uncountedMethods := fs.String("uncounted-methods", "", "comma-separated HTTP methods that are logged but never rate limited (e.g. HEAD,OPTIONS)")
+	lockdownAllow := fs.String("lockdown-allowlist", "", "comma-separated IPs/CIDRs still allowed during lockdown")
+	exemptPrivate := fs.Bool("exempt-private-ips", false, "never rate limit loopback and private addresses")
+	decisionLog := fs.Bool("decision-log", false, "write each non-ALLOW decision to stdout as a JSON line")
+	escalation := fs.String("escalation", string(config.EscalationFull), "escalation policy: full, ban-only or flag-only")
 	fs.Parse(args)
 
-	d := openDB(*dataDir)
+	// loadConfig builds the config from the defaults, --config and flags. It
+	// runs at startup and again for each POST /api/v1/admin/reload.
+	loadConfig := func() (config.Config, error) {
+		cfg := config.DefaultConfig()
+		if *configPath != "" {
+			loaded, err := config.LoadFile(*configPath, cfg)
+			if err != nil {
+				return cfg, err
+			}
+			cfg = loaded
+		}
+
+		// Explicit flags take precedence over the config file.
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "data-dir":
+				cfg.DataDir = *dataDir
+			case "addr":
+				cfg.Addr = *addr
+			case "base-path":
+				cfg.BasePath = *basePath
+			case "blocklist-url":
+				cfg.BlocklistURL = *blocklist
+			case "read-header-timeout":
+				cfg.ReadHeaderTimeout = *readHeaderTimeout
+			case "read-timeout":
+				cfg.ReadTimeout = *readTimeout
+			case "write-timeout":
+				cfg.WriteTimeout = *writeTimeout
+			case "idle-timeout":
+				cfg.IdleTimeout = *idleTimeout
+			case "body-read-timeout":
+				cfg.BodyReadTimeout = *bodyReadTimeout
+			case "error-status-limit":
+				cfg.ErrorStatusLimit = *errorStatusLimit
+			case "distinct-path-threshold":
+				cfg.DistinctPathThreshold = *distinctPathThreshold
+			case "banned-methods":
+				cfg.BannedMethods = strings.Split(*bannedMethods, ",")
+			case "uncounted-methods":
+				cfg.UncountedMethods = strings.Split(*uncountedMethods, ",")
+			case "lockdown-allowlist":
+				cfg.LockdownAllowlist = strings.Split(*lockdownAllow, ",")
+			case "exempt-private-ips":
+				cfg.ExemptPrivateIPs = *exemptPrivate
+			case "decision-log":
+				cfg.DecisionLogEnabled = *decisionLog
+			case "escalation":
+				cfg.Escalation = config.EscalationPolicy(*escalation)
+			}
+		})
+		if *inMemory {
+			cfg.DataDir = db.MemoryDataDir
+		}
+
+		switch cfg.Escalation {
+		case config.EscalationFull, config.EscalationBanOnly, config.EscalationFlagOnly:
+		default:
+			return cfg, fmt.Errorf("unknown escalation policy %q", cfg.Escalation)
+		}
+		// Other statuses would make clients treat FLAG as an error, and
+		// ones outside 100-999 make WriteHeader panic.
+		if c := cfg.FlagStatusCode; c != 0 && (c < 200 || c > 299) {
+			return cfg, fmt.Errorf("flag status code %d is not a 2xx status", c)
+		}
+		for _, patterns := range [][]string{cfg.BannedUserAgents, cfg.AllowedUserAgents} {
+			if _, err := logic.CompileUserAgentPatterns(patterns); err != nil {
+				return cfg, err
+			}
+		}
+		return cfg, nil
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+
+	d := openDB(cfg.DataDir)
 	defer d.Close()
 	adminToken, err := ensureAdminToken(d)
 	if err != nil {
 		log.Fatalf("admin: %v", err)
 	}
-
-	cfg := config.DefaultConfig()
-	cfg.DataDir = *dataDir
-	cfg.Addr = *addr
 	cfg.AdminToken = adminToken
 
 	lim := logic.NewLimiter(cfg, d)
+	defer lim.Close() // before d.Close, so ban write retries stop first
 	if err := lim.LoadBans(); err != nil {
 		log.Fatalf("load bans: %v", err)
 	}
+	if err := lim.Restore(); err != nil {
+		log.Printf("restore limiter state: %v", err)
+	}
 
 	// Start background DB cleanup (expired bans, vacuum).
 	cleanupCtx, cleanupCancel := context.WithCancel(context.Background())
 	defer cleanupCancel()
 	lim.StartCleanup(cleanupCtx)
+	lim.StartBlocklistRefresh(cleanupCtx)
+	lim.StartStatsSampler(cleanupCtx)
 
 	srv, err := httpapi.NewServer(cfg, d, lim, adminToken)
 	if err != nil {
 		log.Fatalf("server: %v", err)
 	}
+	if *configPath != "" {
+		srv.SetConfigLoader(loadConfig)
+	}
 
 	log.Printf("tower listening on %s", cfg.Addr)
 	log.Printf("admin token: %s", adminToken)
 	log.Printf("data dir: %s", filepath.Clean(cfg.DataDir))
-	if err := http.ListenAndServe(cfg.Addr, srv.Handler()); err != nil {
+
+	// On SIGINT/SIGTERM, stop accepting requests and snapshot escalation
+	// state so a restart resumes where it left off.
+	hs := srv.HTTPServer()
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-sigCtx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = hs.Shutdown(shutdownCtx)
+	}()
+	if err := hs.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+	if err := lim.Snapshot(); err != nil {
+		log.Printf("snapshot limiter state: %v", err)
+	}
+	log.Printf("tower stopped")
 }
 
 func statusCmd(args []string) {
@@ -154,31 +338,49 @@ func statusCmd(args []string) {
 	fmt.Println("Rate Limit Config")
 	fmt.Println(strings.Repeat("-", 40))
 	fmt.Printf("Request limit:     %d / %s\n", cfg.RequestLimit, cfg.RequestWindow)
+	fmt.Printf("Burst grace:       %d\n", cfg.BurstGrace)
 	fmt.Printf("Throttle limit:    %d violations / %s\n", cfg.ThrottleLimit, cfg.ThrottleWindow)
 	fmt.Printf("Ban duration:      %s\n", cfg.BanDuration)
+	fmt.Printf("Escalation:        %s\n", cfg.Escalation)
 	fmt.Printf("In-memory log cap: %d\n", cfg.InMemoryLogLimit)
 }
 
 func banIPCmd(args []string) {
 	fs := flag.NewFlagSet("ban-ip", flag.ExitOnError)
 	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
 	ip := fs.String("ip", "", "ip to ban")
 	reason := fs.String("reason", "manual ban", "reason")
-	duration := fs.Duration("duration", 24*time.Hour, "ban duration (0 for permanent)")
+	note := fs.String("note", "", "private note shown to admins only")
+	duration := fs.Duration("duration", 0, "ban duration (0 for permanent); defaults to the config's reason_durations, then ban_duration")
+	configPath := fs.String("config", "", "JSON config file providing reason_durations and ban_duration")
 	fs.Parse(args)
 
 	if *ip == "" {
 		log.Fatal("--ip required")
 	}
+	cfg := config.DefaultConfig()
+	if *configPath != "" {
+		loaded, err := config.LoadFile(*configPath, cfg)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		cfg = loaded
+	}
+	dur := logic.DefaultBanDuration
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "duration" {
+			dur = *duration
+		}
+	})
 
 	d := openDB(*dataDir)
 	defer d.Close()
-	cfg := config.DefaultConfig()
-	lim := logic.NewLimiter(cfg, d)
+	lim := logic.NewLimiter(cfg, d.ForTenant(*tenant))
 	if err := lim.LoadBans(); err != nil {
 		log.Fatalf("load bans: %v", err)
 	}
-	b, err := lim.RecordManualBan(*ip, *reason, *duration)
+	b, err := lim.RecordManualBanWithNote(*ip, *reason, *note, dur)
 	if err != nil {
 		log.Fatalf("ban ip: %v", err)
 	}
@@ -188,6 +390,7 @@ func banIPCmd(args []string) {
 func unbanIPCmd(args []string) {
 	fs := flag.NewFlagSet("unban-ip", flag.ExitOnError)
 	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
 	ip := fs.String("ip", "", "ip to unban")
 	fs.Parse(args)
 
@@ -198,7 +401,7 @@ func unbanIPCmd(args []string) {
 	d := openDB(*dataDir)
 	defer d.Close()
 	cfg := config.DefaultConfig()
-	lim := logic.NewLimiter(cfg, d)
+	lim := logic.NewLimiter(cfg, d.ForTenant(*tenant))
 	if err := lim.Unban(*ip); err != nil {
 		log.Fatalf("unban ip: %v", err)
 	}
@@ -208,11 +411,13 @@ func unbanIPCmd(args []string) {
 func listBansCmd(args []string) {
 	fs := flag.NewFlagSet("list-bans", flag.ExitOnError)
 	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
+	reason := fs.String("reason", "", "only list bans whose reason contains this substring")
 	fs.Parse(args)
 
 	d := openDB(*dataDir)
 	defer d.Close()
-	bans, err := d.ListBans()
+	bans, err := d.ForTenant(*tenant).ListBansFiltered(*reason, -1, 0)
 	if err != nil {
 		log.Fatalf("list bans: %v", err)
 	}
@@ -221,3 +426,392 @@ func listBansCmd(args []string) {
 	}
 }
 
+func softListIPCmd(args []string) {
+	fs := flag.NewFlagSet("soft-list-ip", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
+	ip := fs.String("ip", "", "ip or CIDR to soft-list")
+	remove := fs.Bool("remove", false, "remove the ip from the soft list")
+	list := fs.Bool("list", false, "print the soft list")
+	fs.Parse(args)
+
+	d := openDB(*dataDir)
+	defer d.Close()
+	td := d.ForTenant(*tenant)
+	if *list {
+		entries, err := td.ListSoftListed()
+		if err != nil {
+			log.Fatalf("list soft list: %v", err)
+		}
+		for _, e := range entries {
+			fmt.Println(e)
+		}
+		return
+	}
+	if *ip == "" {
+		log.Fatal("--ip required")
+	}
+	if *remove {
+		if err := td.UnsoftListIP(*ip); err != nil {
+			log.Fatalf("soft-list ip: %v", err)
+		}
+		fmt.Printf("removed %s from soft list\n", *ip)
+		return
+	}
+	if err := td.SoftListIP(*ip); err != nil {
+		log.Fatalf("soft-list ip: %v", err)
+	}
+	fmt.Printf("soft-listed %s\n", *ip)
+}
+
+func noteIPCmd(args []string) {
+	fs := flag.NewFlagSet("note-ip", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
+	ip := fs.String("ip", "", "ip to annotate")
+	note := fs.String("note", "", "note text")
+	author := fs.String("author", os.Getenv("USER"), "who wrote the note")
+	list := fs.Bool("list", false, "print the ip's notes instead of adding one")
+	fs.Parse(args)
+
+	if net.ParseIP(*ip) == nil {
+		log.Fatal("valid --ip required")
+	}
+	d := openDB(*dataDir)
+	defer d.Close()
+	td := d.ForTenant(*tenant)
+	if *list {
+		notes, err := td.ListIPNotes(*ip)
+		if err != nil {
+			log.Fatalf("list notes: %v", err)
+		}
+		for _, n := range notes {
+			fmt.Printf("%s\t%s\t%s\n", n.CreatedAt.Format(time.RFC3339), n.Author, n.Note)
+		}
+		return
+	}
+	if strings.TrimSpace(*note) == "" {
+		log.Fatal("--note required")
+	}
+	if _, err := td.AddIPNote(db.IPNote{IP: *ip, Note: *note, Author: *author}); err != nil {
+		log.Fatalf("note ip: %v", err)
+	}
+	fmt.Printf("noted %s\n", *ip)
+}
+
+func setAdminPasswordCmd(args []string) {
+	fs := flag.NewFlagSet("set-admin-password", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	password := fs.String("password", "", "admin password")
+	fs.Parse(args)
+
+	if *password == "" {
+		log.Fatal("--password required")
+	}
+
+	d := openDB(*dataDir)
+	defer d.Close()
+	hash, err := httpapi.HashAdminPassword(*password)
+	if err != nil {
+		log.Fatalf("hash password: %v", err)
+	}
+	if err := d.SetSetting(httpapi.AdminPasswordSetting, hash); err != nil {
+		log.Fatalf("set admin password: %v", err)
+	}
+	fmt.Println("admin password set")
+}
+
+func generateConfigCmd(args []string) {
+	fs := flag.NewFlagSet("generate-config", flag.ExitOnError)
+	out := fs.String("out", "tower.json", "file to write (- for stdout)")
+	fs.Parse(args)
+
+	b, err := config.MarshalFile(config.DefaultConfig())
+	if err != nil {
+		log.Fatalf("generate config: %v", err)
+	}
+	if *out == "-" {
+		_, _ = os.Stdout.Write(b)
+		return
+	}
+	if err := os.WriteFile(*out, b, 0o644); err != nil {
+		log.Fatalf("write config: %v", err)
+	}
+	fmt.Printf("wrote %s\n", *out)
+}
+
+func lockdownCmd(args []string) {
+	fs := flag.NewFlagSet("lockdown", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	fs.Parse(args)
+
+	var on bool
+	switch fs.Arg(0) {
+	case "on":
+		on = true
+	case "off":
+	default:
+		log.Fatal("usage: tower lockdown [--data-dir dir] on|off")
+	}
+
+	d := openDB(*dataDir)
+	defer d.Close()
+	lim := logic.NewLimiter(config.DefaultConfig(), d)
+	if err := lim.SetLockdown(on); err != nil {
+		log.Fatalf("lockdown: %v", err)
+	}
+	fmt.Printf("lockdown %s\n", fs.Arg(0))
+}
+
+func simulateCmd(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	file := fs.String("file", "", "access log in common or combined format (- for stdin)")
+	configPath := fs.String("config", "", "JSON config file with the thresholds to test")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	fs.Parse(args)
+
+	if *file == "" {
+		log.Fatal("--file required")
+	}
+	cfg := config.DefaultConfig()
+	if *configPath != "" {
+		loaded, err := config.LoadFile(*configPath, cfg)
+		if err != nil {
+			log.Fatalf("config: %v", err)
+		}
+		cfg = loaded
+	}
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			log.Fatalf("open log: %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	res, err := logic.Simulate(cfg, in)
+	if err != nil {
+		log.Fatalf("simulate: %v", err)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(res)
+		return
+	}
+
+	fmt.Println("Simulation")
+	fmt.Println(strings.Repeat("-", 40))
+	fmt.Printf("Requests:          %d\n", res.Lines)
+	fmt.Printf("Unparsed lines:    %d\n", res.Skipped)
+	for _, a := range []logic.Action{logic.ActionAllow, logic.ActionFlag, logic.ActionThrottle, logic.ActionBan} {
+		fmt.Printf("%-18s %d\n", string(a)+":", res.Actions[a])
+	}
+	fmt.Println()
+	fmt.Printf("Banned IPs (%d)\n", len(res.Banned))
+	fmt.Println(strings.Repeat("-", 40))
+	for _, ip := range res.Banned {
+		fmt.Println(ip)
+	}
+}
+
+func uiLinkCmd(args []string) {
+	fs := flag.NewFlagSet("ui-link", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	ttl := fs.Duration("ttl", time.Hour, "how long the link stays valid")
+	baseURL := fs.String("base-url", "http://localhost:8080", "public URL of the tower server")
+	path := fs.String("path", "/ui/stats", "admin page the link opens")
+	fs.Parse(args)
+
+	if *ttl <= 0 {
+		log.Fatal("--ttl must be positive")
+	}
+	d := openDB(*dataDir)
+	defer d.Close()
+	adminToken, err := ensureAdminToken(d)
+	if err != nil {
+		log.Fatalf("admin: %v", err)
+	}
+	exp := time.Now().Add(*ttl)
+	q := url.Values{httpapi.AccessLinkParam: {httpapi.SignAccessLink(adminToken, exp)}}
+	fmt.Printf("%s%s?%s\n", strings.TrimRight(*baseURL, "/"), *path, q.Encode())
+	fmt.Printf("expires %s\n", exp.UTC().Format(time.RFC3339))
+}
+
+func fsckCmd(args []string) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	fix := fs.Bool("fix", false, "delete expired and malformed bans")
+	fs.Parse(args)
+
+	d := openDB(*dataDir)
+	defer d.Close()
+	rep, err := d.Fsck(*fix)
+	if err != nil {
+		log.Fatalf("fsck: %v", err)
+	}
+	if len(rep.Integrity) == 0 {
+		fmt.Println("integrity: ok")
+	}
+	for _, msg := range rep.Integrity {
+		fmt.Printf("integrity: %s\n", msg)
+	}
+	fmt.Printf("expired bans: %d\n", rep.ExpiredBans)
+	fmt.Printf("malformed bans: %d\n", rep.MalformedBans)
+	if rep.Fixed {
+		fmt.Println("deleted expired and malformed bans")
+	}
+	if len(rep.Integrity) > 0 || (!rep.OK() && !rep.Fixed) {
+		os.Exit(1)
+	}
+}
+
+func reportCmd(args []string) {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	tenant := tenantFlag(fs)
+	since := fs.Duration("since", 24*time.Hour, "report on decisions this far back")
+	fs.Parse(args)
+
+	d := openDB(*dataDir)
+	defer d.Close()
+	td := d.ForTenant(*tenant)
+	until := time.Now()
+	from := until.Add(-*since)
+	fmt.Printf("decisions since %s:\n", from.UTC().Format(time.RFC3339))
+	for _, action := range []logic.Action{logic.ActionFlag, logic.ActionThrottle, logic.ActionBan} {
+		n, err := td.CountDecisions(string(action), from, until)
+		if err != nil {
+			log.Fatalf("count decisions: %v", err)
+		}
+		fmt.Printf("%-9s %d\n", action, n)
+	}
+}
+
+// actionColors are the ANSI colors tail prints each action in.
+var actionColors = map[logic.Action]string{
+	logic.ActionFlag:     "\033[36m", // cyan
+	logic.ActionThrottle: "\033[33m", // yellow
+	logic.ActionBan:      "\033[31m", // red
+}
+
+func tailCmd(args []string) {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	addr := fs.String("addr", "http://localhost:8080", "URL of the running tower server")
+	filter := fs.String("filter", "", "comma-separated actions to show, e.g. BAN,THROTTLE (empty shows all)")
+	tenant := fs.String("tenant", "", "only show decisions for this tenant")
+	noColor := fs.Bool("no-color", os.Getenv("NO_COLOR") != "", "print without ANSI colors")
+	key := fs.String("key", "", "admin token of the server (default: read from --data-dir)")
+	fs.Parse(args)
+
+	adminToken := *key
+	if adminToken == "" {
+		tok, err := readAdminToken(*dataDir)
+		if err != nil {
+			log.Fatalf("admin: %v", err)
+		}
+		adminToken = tok
+	}
+	show := map[logic.Action]bool{}
+	for _, a := range strings.Split(*filter, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			show[logic.Action(strings.ToUpper(a))] = true
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	client := tower.New(strings.TrimRight(*addr, "/"), adminToken)
+	err := client.StreamDecisions(ctx, func(ev tower.DecisionEvent) error {
+		if len(show) > 0 && !show[ev.Action] {
+			return nil
+		}
+		if *tenant != "" && ev.Tenant != *tenant {
+			return nil
+		}
+		fmt.Println(formatEvent(ev, !*noColor))
+		return nil
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatalf("tail: %v", err)
+	}
+}
+
+// formatEvent renders ev as one tail line, coloring the action when color is
+// set.
+func formatEvent(ev tower.DecisionEvent, color bool) string {
+	action := fmt.Sprintf("%-8s", ev.Action)
+	if c, ok := actionColors[ev.Action]; ok && color {
+		action = c + action + "\033[0m"
+	}
+	line := fmt.Sprintf("%s %s %-15s %s %s", ev.TS.Local().Format("15:04:05"), action, ev.IP, ev.Method, ev.Path)
+	if ev.Tenant != "" {
+		line += " tenant=" + ev.Tenant
+	}
+	if ev.UserID != "" {
+		line += " user=" + ev.UserID
+	}
+	if ev.Code != "" {
+		line += " code=" + ev.Code
+	}
+	if ev.Reason != "" {
+		line += " (" + ev.Reason + ")"
+	}
+	return line
+}
+
+func quickstartCmd(args []string) {
+	fs := flag.NewFlagSet("quickstart", flag.ExitOnError)
+	dataDir := commonFlags(fs)
+	addr := fs.String("addr", "http://localhost:8080", "URL of the tower server")
+	fs.Parse(args)
+
+	if err := quickstart(os.Stdout, *dataDir, *addr); err != nil {
+		log.Fatalf("admin: %v", err)
+	}
+}
+
+// quickstart writes the admin key for dataDir, creating it if needed, and Go
+// SDK and curl snippets that use it against the server at addr.
+func quickstart(w io.Writer, dataDir, addr string) error {
+	d := openDB(dataDir)
+	key, err := ensureAdminToken(d)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	base := strings.TrimRight(addr, "/")
+
+	hc := http.Client{Timeout: time.Second}
+	if resp, err := hc.Get(base + "/healthz"); err == nil && resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		fmt.Fprintf(w, "tower is running at %s\n", base)
+	} else {
+		if err == nil {
+			resp.Body.Close()
+		}
+		fmt.Fprintf(w, "tower is not reachable at %s; start it with:\n  tower serve --data-dir %s\n", base, dataDir)
+	}
+	fmt.Fprintf(w, "\nAPI key: %s\n", key)
+
+	fmt.Fprintf(w, `
+Go SDK:
+
+	c := tower.New(%q, %q)
+	_, err := c.LogRequest(ctx, r.Method, r.URL.Path, clientIP)
+	if errors.Is(err, tower.ErrBanned) || errors.Is(err, tower.ErrThrottled) {
+		// deny the request
+	}
+
+curl:
+
+	curl -s -X POST %s/api/v1/log \
+	  -H 'X-Tower-Key: %s' -H 'Content-Type: application/json' \
+	  -d '{"method":"GET","path":"/login","ip":"198.51.100.7"}'
+`, base, key, base, key)
+	return nil
+}
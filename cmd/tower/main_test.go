@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"tower/api"
+	"tower/internal/config"
+	"tower/internal/httpapi"
+	"tower/internal/logic"
+	"tower/sdk/go/tower"
+)
+
+func TestQuickstart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.DataDir = dir
+
+	d := openDB(dir)
+	defer d.Close()
+	adminToken, err := ensureAdminToken(d)
+	if err != nil {
+		t.Fatalf("ensureAdminToken: %v", err)
+	}
+	lim := logic.NewLimiter(cfg, d)
+	defer lim.Close()
+	srv, err := httpapi.NewServer(cfg, d, lim, adminToken)
+	if err != nil {
+		t.Fatalf("httpapi.NewServer: %v", err)
+	}
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	var out bytes.Buffer
+	if err := quickstart(&out, dir, ts.URL+"/"); err != nil {
+		t.Fatalf("quickstart: %v", err)
+	}
+	printed := out.String()
+	t.Logf("[QUICKSTART] output:\n%s", printed)
+
+	m := regexp.MustCompile(`(?m)^API key: (\S+)$`).FindStringSubmatch(printed)
+	if m == nil || m[1] != adminToken {
+		t.Fatalf("[QUICKSTART] expected the server's admin key %q, got %v", adminToken, m)
+	}
+	for _, want := range []string{
+		"tower is running at " + ts.URL + "\n",
+		fmt.Sprintf("tower.New(%q, %q)", ts.URL, adminToken),
+		"curl -s -X POST " + ts.URL + "/api/v1/log",
+		"-H 'X-Tower-Key: " + adminToken + "'",
+	} {
+		if !strings.Contains(printed, want) {
+			t.Fatalf("[QUICKSTART] output missing %q", want)
+		}
+	}
+
+	// The printed key works against the running server.
+	got, err := tower.New(ts.URL, m[1]).LogRequest(context.Background(), "GET", "/login", "198.51.100.7")
+	if err != nil || got.Action != api.ActionAllow {
+		t.Fatalf("[QUICKSTART] expected the printed key to log ALLOW, got %+v (err=%v)", got, err)
+	}
+}
+
+func TestFormatEvent(t *testing.T) {
+	ev := tower.DecisionEvent{
+		TS:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+		Action: api.ActionBan,
+		IP:     "198.51.100.7",
+		Method: "GET",
+		Path:   "/",
+		UserID: "alice",
+		Code:   "UA_BLOCKED",
+		Reason: "auto-ban: blocked user agent",
+	}
+	want := "03:04:05 BAN      198.51.100.7    GET / user=alice code=UA_BLOCKED (auto-ban: blocked user agent)"
+	if got := formatEvent(ev, false); got != want {
+		t.Fatalf("formatEvent:\n got %q\nwant %q", got, want)
+	}
+}
@@ -2,7 +2,10 @@ module tower
 
 go 1.24.0
 
-require modernc.org/sqlite v1.45.0
+require (
+	golang.org/x/crypto v0.43.0
+	modernc.org/sqlite v1.45.0
+)
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
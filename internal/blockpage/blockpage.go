@@ -0,0 +1,98 @@
+// Package blockpage renders blocked responses as HTML or plain text for
+// clients that prefer them over JSON. It is shared by the server and the SDK
+// middleware.
+package blockpage
+
+import (
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tower/api"
+)
+
+// Default is the HTML page shown to browsers that are blocked, rendered with
+// an api.BlockedPage.
+const Default = `<!doctype html>
+<html><head><title>{{.Title}}</title></head>
+<body>
+<h1>{{.Title}}</h1>
+{{if .Reason}}<p>{{.Reason}}</p>
+{{end}}{{if .RetryAfter}}<p>Try again in {{.RetryAfter}} seconds.</p>
+{{end}}</body></html>
+`
+
+var defaultTemplate = template.Must(template.New("blocked").Parse(Default))
+
+// Write writes a blocked response for d as an HTML page (from tmpl, or
+// Default when nil) or plain text when r's Accept header
+// prefers one of them, and reports whether it did. It returns false, having
+// written nothing, when JSON is preferred or Accept is absent, leaving the
+// JSON body to the caller.
+func Write(w http.ResponseWriter, r *http.Request, status int, d api.Decision, tmpl *template.Template) bool {
+	page := api.BlockedPage{Decision: d, Status: status, Title: http.StatusText(status)}
+	switch negotiate(r.Header.Get("Accept")) {
+	case "text/html":
+		if tmpl == nil {
+			tmpl = defaultTemplate
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, page); err != nil {
+			b.Reset()
+			_ = defaultTemplate.Execute(&b, page)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(b.String()))
+	case "text/plain":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		fmt.Fprintln(w, page.Title)
+		if d.Reason != "" {
+			fmt.Fprintln(w, d.Reason)
+		}
+		if d.RetryAfter > 0 {
+			fmt.Fprintf(w, "Try again in %d seconds.\n", d.RetryAfter)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// negotiate picks "application/json", "text/html" or "text/plain" for
+// an Accept header by quality value; ties go to the earlier entry, and JSON
+// is the default.
+func negotiate(accept string) string {
+	best, bestQ := "application/json", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var format string
+		switch mediaType {
+		case "application/json", "application/*", "*/*":
+			format = "application/json"
+		case "text/html", "application/xhtml+xml":
+			format = "text/html"
+		case "text/plain", "text/*":
+			format = "text/plain"
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
@@ -9,17 +9,217 @@ import (
 	"time"
 )
 
+// EscalationPolicy controls how the limiter escalates once an IP exceeds its
+// request limit.
+type EscalationPolicy string
+
+const (
+	// EscalationFull flags the first violation, throttles repeated
+	// violations and bans after ThrottleLimit throttles.
+	EscalationFull EscalationPolicy = "full"
+	// EscalationBanOnly bans an IP as soon as it exceeds the limit.
+	EscalationBanOnly EscalationPolicy = "ban-only"
+	// EscalationFlagOnly flags every violation and never throttles or bans,
+	// for observation-only deployments.
+	EscalationFlagOnly EscalationPolicy = "flag-only"
+)
+
+// Retry-After header formats.
+const (
+	RetryAfterSeconds  = "seconds"
+	RetryAfterHTTPDate = "http-date"
+)
+
+// Config holds the server and limiter settings. A window of 0 or less turns
+// its stage off: RequestWindow disables rate limiting, ThrottleWindow keeps
+// throttling violations but never bans for them, and ErrorStatusWindow
+// disables 4xx-storm detection.
 type Config struct {
 	DataDir          string
 	Addr             string
+	BasePath         string // path prefix for every route, e.g. "/tower" behind a proxy
 	RequestWindow    time.Duration
 	RequestLimit     int
+	BurstGrace       int // extra requests allowed above RequestLimit before flagging
 	ThrottleWindow   time.Duration
 	ThrottleLimit    int
 	BanDuration      time.Duration
+	Escalation       EscalationPolicy // empty means EscalationFull
 	InMemoryLogLimit int
-	AdminToken      string
-	CleanupInterval time.Duration // how often the background cleanup runs
+	MaxCachedBans    int    // active bans loaded into memory at startup; 0 for no cap
+	MaxTenants       int    // tenant limiters kept in memory; 0 for no cap
+	MaxBodyBytes     int64  // maximum request body size read by API handlers
+	RetryAfterFormat string // RetryAfterSeconds (default) or RetryAfterHTTPDate
+	AdminToken       string
+	CleanupInterval  time.Duration // how often the background cleanup runs
+
+	// TenantIdleTimeout evicts tenant limiters unused for this long at
+	// cleanup. Their bans and escalation state are kept and reloaded on the
+	// next request; tenants with callbacks are never evicted. 0 disables.
+	TenantIdleTimeout time.Duration
+
+	// ReasonDurations maps ban reason prefixes (case-insensitive, longest
+	// match wins) to the duration of manual bans made without an explicit
+	// one, e.g. {"spam": 1h, "abuse": 168h, "fraud": 0}; 0 is permanent.
+	// Unmatched reasons use BanDuration.
+	ReasonDurations map[string]time.Duration
+
+	// LogBodyBytes keeps up to this many bytes of each logged request's body
+	// in the recent request log, for debugging abuse. 0, the default, never
+	// keeps bodies.
+	LogBodyBytes int
+
+	// MaxHeaderBytes caps the size of request headers the HTTP server
+	// reads; 0 uses net/http's 1 MB default.
+	MaxHeaderBytes int
+
+	// StatsSampleInterval is how often limiter statistics (active bans,
+	// flagged IPs, ...) are recorded for trend graphs; 0 disables sampling.
+	// Samples are kept for StatsRetention, or forever when it is 0.
+	StatsSampleInterval time.Duration
+	StatsRetention      time.Duration
+
+	// DecisionRetention persists FLAG, THROTTLE and BAN decisions for
+	// reporting (tower report, /api/v1/admin/decisions/count) and keeps them
+	// this long (7 days by default); 0 records nothing. Decisions are
+	// buffered and written in batches, off the request path.
+	DecisionRetention time.Duration
+
+	// FlagStatusCode is the /api/v1/log status for FLAG decisions, which
+	// also carry X-Tower-Flagged: true; 0 means 200, like ALLOW. serve
+	// rejects anything but a 2xx status.
+	FlagStatusCode int
+
+	// CallbackDedupWindow suppresses callbacks repeating the same action for
+	// the same IP within this window, e.g. a banned IP that keeps hitting
+	// /api/v1/log; 0 sends every event.
+	CallbackDedupWindow time.Duration
+
+	// NormalizePaths cleans logged paths ("//a/./b/../c." becomes "/a/c")
+	// so obfuscated probes match the plain path; the original is kept as
+	// RawPath. LowercasePaths also lowercases them.
+	NormalizePaths bool
+	LowercasePaths bool
+
+	// MaxConcurrentPerIP caps API requests in flight at once from one IP,
+	// against slow-request attacks; 0 disables it. The IP is the connection
+	// address unless it is one of TrustedProxies.
+	MaxConcurrentPerIP int
+
+	// StartupGracePeriod caps enforcement at FLAG for this long after
+	// startup, while reconnecting clients spike traffic; 0 disables it.
+	StartupGracePeriod time.Duration
+
+	// GoodBehaviorWindow clears an IP's throttle strikes once it has gone
+	// this long without exceeding the limit; 0 keeps strikes for the full
+	// ThrottleWindow.
+	GoodBehaviorWindow time.Duration
+
+	// ErrorStatusLimit is the number of 4xx responses an IP may produce within
+	// ErrorStatusWindow before its traffic counts as a violation; 0 disables it.
+	ErrorStatusLimit  int
+	ErrorStatusWindow time.Duration
+	BannedMethods     []string // requests with any of these methods are banned outright
+
+	// DistinctPathThreshold is the number of distinct paths an IP may touch
+	// within DistinctPathWindow; beyond it the IP is flagged as a scanner,
+	// then banned if it keeps going. 0 disables it.
+	DistinctPathThreshold int
+	DistinctPathWindow    time.Duration
+
+	// BannedUserAgents bans requests whose User-Agent matches one of these
+	// patterns outright, unless it also matches AllowedUserAgents (for
+	// known-good bots). Entries are case-insensitive globs matched against
+	// the whole User-Agent, or regular expressions between slashes, e.g.
+	// "/sqlmap|nikto/". The allowlist only overrides this list.
+	BannedUserAgents  []string
+	AllowedUserAgents []string
+
+	// RateLimitKey is the template for the key request windows are tracked
+	// under: "{ip}" (the default), "{user}" or combinations with "{path}"
+	// such as "{ip}:{path}" or "{user}:{path}" for per-endpoint quotas.
+	// {user} is the user logged with the request, or the IP without one.
+	// Flags, throttles and bans always apply to the IP.
+	RateLimitKey string
+
+	// RetryAfterJitter spreads the Retry-After of THROTTLE decisions
+	// uniformly over ±this around the request window, so throttled clients
+	// do not all retry at once; 0, the default, keeps it exact.
+	RetryAfterJitter time.Duration
+
+	// BlockedPageTemplate is the path of an html/template file rendered for
+	// blocked requests (BAN, THROTTLE) whose Accept header prefers HTML,
+	// with an api.BlockedPage; empty uses the SDK's DefaultBlockedPage.
+	BlockedPageTemplate string
+
+	// MetricsBuckets are the upper bounds, in seconds, of the latency
+	// histogram buckets on /metrics; empty uses logic.DefaultMetricsBuckets.
+	MetricsBuckets []float64
+
+	// UncountedMethods, such as HEAD or OPTIONS from monitoring, are kept in
+	// the recent request log but always allowed and never counted toward
+	// the request limit. Empty counts every method.
+	UncountedMethods []string
+
+	// HTTP server timeouts; zero disables the corresponding timeout.
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	BodyReadTimeout   time.Duration // max time to read an API request's JSON body; 408 after
+
+	// DecisionHookURL, when set, is POSTed every non-ALLOW decision during
+	// LogRequest and may answer with an overriding action.
+	DecisionHookURL     string
+	DecisionHookTimeout time.Duration
+
+	// BlocklistURL points at a newline-separated list of IPs/CIDRs that is
+	// periodically imported as bans. Empty disables the import.
+	BlocklistURL             string
+	BlocklistRefreshInterval time.Duration
+
+	// ReadinessChecksCallbacks makes /readyz probe every registered callback
+	// and report degraded when none of them is reachable. Each result is
+	// reused for 10s, however often /readyz is hit.
+	ReadinessChecksCallbacks bool
+
+	// MaxCallbacks caps the callback URLs registered per tenant; 0 for no cap.
+	MaxCallbacks int
+	// CallbackBlockPrivate rejects callback URLs pointing at loopback,
+	// private or link-local IP literals and localhost, as an SSRF guard.
+	// Delivery also refuses hostnames that resolve to such addresses.
+	CallbackBlockPrivate bool
+
+	// Callback delivery client tuning. Connections are kept alive and
+	// HTTP/2 is used when the receiver supports it. CallbackIdleConns is the
+	// number of idle connections kept per receiver host.
+	CallbackTimeout   time.Duration // 0 means 5s
+	CallbackIdleConns int
+
+	// DecisionLogEnabled writes every non-ALLOW decision to stdout as a
+	// single-line JSON event for log shippers.
+	DecisionLogEnabled bool
+
+	// LockdownAllowlist lists IPs and CIDRs still allowed while lockdown
+	// mode is on.
+	LockdownAllowlist []string
+
+	// ExemptPrivateIPs always allows loopback and private (RFC 1918, RFC 4193)
+	// addresses without rate limiting them.
+	ExemptPrivateIPs bool
+
+	// RealIPHeader names a header, such as CF-Connecting-IP, holding the
+	// client IP set by a CDN. It is only honored on connections from
+	// TrustedProxies (IPs or CIDRs); otherwise X-Forwarded-For and the
+	// remote address are used as before. Once TrustedProxies is set,
+	// X-Forwarded-For is also ignored from any other peer.
+	RealIPHeader   string
+	TrustedProxies []string
+
+	// RequireHTTPS rejects API and login requests with 403 unless they
+	// arrive over TLS or from TrustedProxies with X-Forwarded-Proto: https.
+	// Health checks are exempt.
+	RequireHTTPS bool
 }
 
 func DefaultDataDir() string {
@@ -38,15 +238,39 @@ func DefaultDataDir() string {
 
 func DefaultConfig() Config {
 	return Config{
-		DataDir:          DefaultDataDir(),
-		Addr:             ":8080",
-		RequestWindow:    60 * time.Second,
-		RequestLimit:     120,
-		ThrottleWindow:   24 * time.Hour,
-		ThrottleLimit:    5,
-		BanDuration:      24 * time.Hour,
-		InMemoryLogLimit: 5000,
-		CleanupInterval:  1 * time.Hour,
+		DataDir:                  DefaultDataDir(),
+		Addr:                     ":8080",
+		RequestWindow:            60 * time.Second,
+		RequestLimit:             120,
+		ThrottleWindow:           24 * time.Hour,
+		ThrottleLimit:            5,
+		BanDuration:              24 * time.Hour,
+		ErrorStatusWindow:        60 * time.Second,
+		DistinctPathWindow:       60 * time.Second,
+		Escalation:               EscalationFull,
+		InMemoryLogLimit:         5000,
+		MaxCachedBans:            100000,
+		MaxTenants:               1000,
+		TenantIdleTimeout:        time.Hour,
+		MaxBodyBytes:             1 << 20,
+		RetryAfterFormat:         RetryAfterSeconds,
+		CleanupInterval:          1 * time.Hour,
+		ReadHeaderTimeout:        5 * time.Second,
+		ReadTimeout:              15 * time.Second,
+		WriteTimeout:             30 * time.Second,
+		IdleTimeout:              120 * time.Second,
+		BodyReadTimeout:          10 * time.Second,
+		DecisionHookTimeout:      250 * time.Millisecond,
+		BlocklistRefreshInterval: 1 * time.Hour,
+		MaxCallbacks:             32,
+		CallbackTimeout:          5 * time.Second,
+		CallbackIdleConns:        16,
+		CallbackDedupWindow:      time.Minute,
+		FlagStatusCode:           200,
+		DecisionRetention:        7 * 24 * time.Hour,
+		MaxHeaderBytes:           64 << 10,
+		StatsSampleInterval:      5 * time.Minute,
+		StatsRetention:           7 * 24 * time.Hour,
 	}
 }
 
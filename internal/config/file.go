@@ -0,0 +1,242 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// fileComments documents config file keys. They are written under
+// "_comments" by MarshalFile and ignored when loading.
+var fileComments = map[string]string{
+	"data_dir":                   "Directory holding tower.db.",
+	"addr":                       "Listen address for serve.",
+	"base_path":                  "Path prefix for every route when served under a sub-path, e.g. \"/tower\".",
+	"request_window":             "Sliding window for the per-IP request limit; 0 disables rate limiting.",
+	"request_limit":              "Requests allowed per IP within request_window.",
+	"burst_grace":                "Extra requests allowed above request_limit before flagging.",
+	"throttle_window":            "Window in which throttles are counted toward a ban; 0 never bans for throttles.",
+	"throttle_limit":             "Throttles within throttle_window that trigger an auto-ban.",
+	"log_body_bytes":             "Bytes of each logged request body kept in the recent log; 0 keeps none.",
+	"max_header_bytes":           "Maximum request header size in bytes; 0 for the net/http default (1 MB).",
+	"stats_sample_interval":      "How often limiter stats are recorded for /ui/stats; 0 disables sampling.",
+	"stats_retention":            "Keep stats samples this long; 0 keeps them forever.",
+	"decision_retention":         "Keep FLAG/THROTTLE/BAN events this long for reports; 0 records none.",
+	"flag_status_code":           "2xx HTTP status /api/v1/log returns for FLAG (X-Tower-Flagged is always set).",
+	"callback_dedup_window":      "Skip callbacks repeating an IP's action within this window; 0 sends all.",
+	"normalize_paths":            "Clean logged paths (duplicate slashes, dot segments, trailing dots) before storing them.",
+	"lowercase_paths":            "Also lowercase paths when normalize_paths is set.",
+	"max_concurrent_per_ip":      "API requests one connection IP (or client IP via trusted_proxies) may have in flight at once; 0 for no cap.",
+	"startup_grace_period":       "After startup, only flag violations for this long; 0 disables.",
+	"good_behavior_window":       "Violation-free period after which throttle strikes are cleared; 0 disables.",
+	"ban_duration":               "Duration of automatic bans.",
+	"reason_durations":           "Manual ban durations by reason prefix, e.g. {\"spam\": \"1h\", \"fraud\": \"0s\"}; 0 is permanent.",
+	"error_status_limit":         "4xx responses per IP within error_status_window before escalating; 0 disables.",
+	"error_status_window":        "Window for error_status_limit; 0 disables it.",
+	"distinct_path_threshold":    "Distinct paths per IP within distinct_path_window before it is flagged, then banned, as a scanner; 0 disables.",
+	"distinct_path_window":       "Window for distinct_path_threshold; 0 disables it.",
+	"banned_methods":             "HTTP methods that are banned outright, e.g. [\"TRACE\"].",
+	"banned_user_agents":         "User-Agent globs, or /regexps/, banned outright, e.g. [\"*sqlmap*\"].",
+	"allowed_user_agents":        "User-Agent patterns exempt from banned_user_agents, e.g. [\"Googlebot*\"].",
+	"rate_limit_key":             "Request window key template from {ip}, {user} and {path}, e.g. \"{user}:{path}\"; empty means {ip}.",
+	"retry_after_jitter":         "Randomize THROTTLE Retry-After by up to ± this much (whole seconds); 0 keeps it exact.",
+	"blocked_page_template":      "html/template file shown to browsers that are banned or throttled; empty for the built-in page.",
+	"metrics_buckets":            "Latency histogram bucket bounds in seconds for /metrics; [] for the defaults.",
+	"uncounted_methods":          "HTTP methods that are logged but never counted or limited, e.g. [\"HEAD\", \"OPTIONS\"].",
+	"escalation":                 "Escalation policy: full, ban-only or flag-only.",
+	"in_memory_log_limit":        "Recent requests kept in memory.",
+	"max_cached_bans":            "Active bans loaded into memory at startup; 0 for no cap.",
+	"max_tenants":                "Tenant limiters kept in memory; the least recently used is evicted past it. 0 for no cap.",
+	"tenant_idle_timeout":        "Evict tenant limiters unused for this long; 0 never does. Evicted tenants keep their bans and escalation state.",
+	"max_body_bytes":             "Maximum API request body size.",
+	"retry_after_format":         "Retry-After header format: seconds or http-date.",
+	"cleanup_interval":           "How often expired bans are purged.",
+	"read_header_timeout":        "HTTP server header read timeout.",
+	"read_timeout":               "HTTP server request read timeout.",
+	"write_timeout":              "HTTP server response write timeout.",
+	"idle_timeout":               "HTTP server keep-alive idle timeout.",
+	"body_read_timeout":          "Max time to read an API request's JSON body before answering 408; 0 disables.",
+	"decision_hook_url":          "URL consulted synchronously to override non-ALLOW decisions.",
+	"decision_hook_timeout":      "Timeout for the decision hook.",
+	"blocklist_url":              "Newline-separated IP/CIDR list imported as bans.",
+	"blocklist_refresh_interval": "How often blocklist_url is re-imported.",
+	"readiness_checks_callbacks": "Fail /readyz when every registered callback is unreachable.",
+	"max_callbacks":              "Callback URLs allowed per tenant; 0 for no cap.",
+	"callback_block_private":     "Reject callback URLs on loopback/private IPs or localhost, and deliveries resolving to them (SSRF guard).",
+	"callback_timeout":           "Timeout for each callback delivery.",
+	"callback_idle_conns":        "Idle keep-alive connections kept per callback host.",
+	"decision_log_enabled":       "Write each non-ALLOW decision to stdout as one JSON line.",
+	"lockdown_allowlist":         "IPs/CIDRs still allowed while lockdown mode is on.",
+	"real_ip_header":             "Header carrying the client IP from a CDN, e.g. CF-Connecting-IP.",
+	"trusted_proxies":            "IPs/CIDRs whose real_ip_header and X-Forwarded-For are trusted; once set, other peers' headers are ignored.",
+	"require_https":              "Reject API and login requests not over HTTPS (directly or per X-Forwarded-Proto from trusted_proxies).",
+	"exempt_private_ips":         "Always allow loopback and private addresses without rate limiting.",
+}
+
+// fileSkip lists Config fields that never appear in a config file.
+var fileSkip = map[string]bool{
+	"AdminToken": true, // generated and stored in the database
+}
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	durationMapType = reflect.TypeOf(map[string]time.Duration(nil))
+)
+
+// MarshalFile renders cfg as an indented JSON config file with snake_case
+// keys, durations as strings such as "24h", and a "_comments" object
+// describing each key.
+func MarshalFile(cfg Config) ([]byte, error) {
+	out := map[string]interface{}{}
+	comments := map[string]string{}
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if fileSkip[f.Name] || !f.IsExported() {
+			continue
+		}
+		key := snakeCase(f.Name)
+		fv := v.Field(i)
+		switch {
+		case f.Type == durationType:
+			out[key] = humanDuration(time.Duration(fv.Int()))
+		case f.Type == durationMapType:
+			m := map[string]string{}
+			for k, d := range fv.Interface().(map[string]time.Duration) {
+				m[k] = humanDuration(d)
+			}
+			out[key] = m
+		case fv.Kind() == reflect.Slice && fv.IsNil():
+			out[key] = []string{}
+		case fv.Kind() == reflect.Func || fv.Kind() == reflect.Interface || fv.Kind() == reflect.Map:
+			continue
+		default:
+			out[key] = fv.Interface()
+		}
+		if c, ok := fileComments[key]; ok {
+			comments[key] = c
+		}
+	}
+	out["_comments"] = comments
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// LoadFile reads a JSON config file written by MarshalFile and applies its
+// keys on top of base. Unknown keys are an error so typos are not silently
+// ignored.
+func LoadFile(path string, base Config) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return base, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return base, fmt.Errorf("%s: %w", path, err)
+	}
+	delete(raw, "_comments")
+
+	v := reflect.ValueOf(&base).Elem()
+	t := v.Type()
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if !fileSkip[t.Field(i).Name] {
+			fields[snakeCase(t.Field(i).Name)] = i
+		}
+	}
+	for key, msg := range raw {
+		i, ok := fields[key]
+		if !ok {
+			return base, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+		fv := v.Field(i)
+		if fv.Type() == durationType {
+			var s string
+			if err := json.Unmarshal(msg, &s); err != nil {
+				return base, fmt.Errorf("%s: %s: duration must be a string like %q", path, key, "24h")
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return base, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			fv.SetInt(int64(d))
+			continue
+		}
+		if fv.Type() == durationMapType {
+			var raw map[string]string
+			if err := json.Unmarshal(msg, &raw); err != nil {
+				return base, fmt.Errorf("%s: %s: durations must be strings like %q", path, key, "24h")
+			}
+			m := make(map[string]time.Duration, len(raw))
+			for k, s := range raw {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return base, fmt.Errorf("%s: %s: %s: %w", path, key, k, err)
+				}
+				m[k] = d
+			}
+			if len(m) == 0 {
+				m = nil
+			}
+			fv.Set(reflect.ValueOf(m))
+			continue
+		}
+		if err := json.Unmarshal(msg, fv.Addr().Interface()); err != nil {
+			return base, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		if fv.Kind() == reflect.Slice && fv.Len() == 0 {
+			fv.Set(reflect.Zero(fv.Type())) // [] means unset, like the nil default
+		}
+	}
+	return base, nil
+}
+
+// FileKey returns the config file key of the Config field named field, such
+// as "request_limit" for RequestLimit.
+func FileKey(field string) string { return snakeCase(field) }
+
+// humanDuration formats d without redundant zero units, so 24h renders as
+// "24h" rather than "24h0m0s".
+func humanDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
+
+// snakeCase converts a Go field name such as DecisionHookURL to
+// decision_hook_url.
+func snakeCase(name string) string {
+	rs := []rune(name)
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && !unicode.IsUpper(rs[i-1])
+			nextLower := i > 0 && i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
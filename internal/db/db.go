@@ -3,21 +3,41 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
+	"log"
+	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"tower/internal/clock"
+
 	_ "modernc.org/sqlite"
 )
 
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	tenant string
+	clock  clock.Clock
 }
 
+// MemoryDataDir is the data dir that opens a private in-memory database
+// instead of a file, for ephemeral and test deployments.
+const MemoryDataDir = ":memory:"
+
+var memoryDBSeq atomic.Int64
+
 func Open(dataDir string) (*DB, error) {
 	if dataDir == "" {
 		return nil, errors.New("data dir required")
 	}
 	path := filepath.Join(dataDir, "tower.db")
+	if dataDir == MemoryDataDir {
+		// A named shared-cache database lets every pooled connection see the
+		// same data while keeping separate Open calls isolated.
+		path = fmt.Sprintf("file:tower-mem-%d-%d?mode=memory&cache=shared", os.Getpid(), memoryDBSeq.Add(1))
+	}
 	conn, err := sql.Open("sqlite", path)
 	if err != nil {
 		return nil, err
@@ -31,11 +51,31 @@ func Open(dataDir string) (*DB, error) {
 		_ = conn.Close()
 		return nil, err
 	}
-	return &DB{conn: conn}, nil
+	if dataDir == MemoryDataDir {
+		// The database vanishes when its last connection closes.
+		conn.SetConnMaxIdleTime(0)
+		conn.SetMaxIdleConns(1)
+	}
+	return &DB{conn: conn, clock: clock.Real{}}, nil
 }
 
 func (d *DB) Close() error { return d.conn.Close() }
 
+// ForTenant returns a handle that shares the underlying connection but scopes
+// all ban queries to the given tenant. The empty string is the default tenant.
+func (d *DB) ForTenant(tenant string) *DB {
+	return &DB{conn: d.conn, tenant: tenant, clock: d.clock}
+}
+
+// Tenant returns the tenant this handle is scoped to.
+func (d *DB) Tenant() string { return d.tenant }
+
+// SetClock replaces the time source used for expiry checks.
+func (d *DB) SetClock(c clock.Clock) { d.clock = c }
+
+// Clock returns the time source used by this handle.
+func (d *DB) Clock() clock.Clock { return d.clock }
+
 func migrate(conn *sql.DB) error {
 	stmts := []string{
 		`CREATE TABLE IF NOT EXISTS settings (
@@ -43,18 +83,126 @@ func migrate(conn *sql.DB) error {
 			value TEXT NOT NULL
 		);`,
 		`CREATE TABLE IF NOT EXISTS banned_ips (
-			ip TEXT PRIMARY KEY,
+			tenant_id TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL,
 			reason TEXT NOT NULL,
 			banned_at TEXT NOT NULL,
-			expires_at TEXT
+			expires_at TEXT,
+			source TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (tenant_id, ip)
+		);`,
+		`CREATE TABLE IF NOT EXISTS limiter_state (
+			tenant_id TEXT PRIMARY KEY,
+			state TEXT NOT NULL,
+			saved_at TEXT NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS soft_listed_ips (
+			tenant_id TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL,
+			added_at TEXT NOT NULL,
+			PRIMARY KEY (tenant_id, ip)
+		);`,
+		`CREATE TABLE IF NOT EXISTS decision_events (
+			tenant_id TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			ip TEXT NOT NULL,
+			at TEXT NOT NULL
 		);`,
+		`CREATE INDEX IF NOT EXISTS decision_events_by_action ON decision_events(tenant_id, action, at);`,
+		`CREATE INDEX IF NOT EXISTS decision_events_by_time ON decision_events(at);`,
+		`CREATE TABLE IF NOT EXISTS stats_samples (
+			tenant_id TEXT NOT NULL DEFAULT '',
+			at TEXT NOT NULL,
+			active_bans INTEGER NOT NULL,
+			flagged_ips INTEGER NOT NULL,
+			tracked_ips INTEGER NOT NULL,
+			recent_requests INTEGER NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS stats_samples_by_time ON stats_samples(tenant_id, at);`,
+		`CREATE TABLE IF NOT EXISTS ip_notes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tenant_id TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL,
+			note TEXT NOT NULL,
+			author TEXT NOT NULL DEFAULT '',
+			created_at TEXT NOT NULL
+		);`,
+		`CREATE INDEX IF NOT EXISTS ip_notes_by_ip ON ip_notes(tenant_id, ip);`,
 	}
 	for _, s := range stmts {
 		if _, err := conn.Exec(s); err != nil {
 			return err
 		}
 	}
-	return nil
+	if err := migrateBanTenants(conn); err != nil {
+		return err
+	}
+	if err := addColumn(conn, "banned_ips", "source", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+	return addColumn(conn, "banned_ips", "note", `TEXT`)
+}
+
+// addColumn adds column to table unless it already exists.
+func addColumn(conn *sql.DB, table, column, decl string) error {
+	ok, err := hasColumn(conn, table, column)
+	if err != nil || ok {
+		return err
+	}
+	_, err = conn.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + decl)
+	return err
+}
+
+// migrateBanTenants rebuilds a pre-tenant banned_ips table so that bans are
+// keyed by (tenant_id, ip). Existing rows move to the default tenant.
+func migrateBanTenants(conn *sql.DB) error {
+	ok, err := hasColumn(conn, "banned_ips", "tenant_id")
+	if err != nil || ok {
+		return err
+	}
+	stmts := []string{
+		`ALTER TABLE banned_ips RENAME TO banned_ips_old;`,
+		`CREATE TABLE banned_ips (
+			tenant_id TEXT NOT NULL DEFAULT '',
+			ip TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			banned_at TEXT NOT NULL,
+			expires_at TEXT,
+			PRIMARY KEY (tenant_id, ip)
+		);`,
+		`INSERT INTO banned_ips(tenant_id,ip,reason,banned_at,expires_at)
+			SELECT '',ip,reason,banned_at,expires_at FROM banned_ips_old;`,
+		`DROP TABLE banned_ips_old;`,
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	for _, s := range stmts {
+		if _, err := tx.Exec(s); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func hasColumn(conn *sql.DB, table, column string) (bool, error) {
+	rows, err := conn.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
 func (d *DB) GetSetting(key string) (string, bool, error) {
@@ -76,70 +224,140 @@ func (d *DB) SetSetting(key, value string) error {
 }
 
 type Ban struct {
-	IP        string
+	Tenant    string
+	IP        string // a single IP or, for imported blocklists, a CIDR range
 	Reason    string
 	BannedAt  time.Time
 	ExpiresAt *time.Time
+	Source    string // who created the ban: "auto", "manual", "blocklist"
+	Note      string // private operator note; never sent to callbacks
 }
 
+// Ban sources.
+const (
+	SourceAuto      = "auto"
+	SourceManual    = "manual"
+	SourceBlocklist = "blocklist"
+)
+
 func (d *DB) BanIP(b Ban) error {
-	_, err := d.conn.Exec(`INSERT INTO banned_ips(ip,reason,banned_at,expires_at) VALUES(?,?,?,?)
-		ON CONFLICT(ip) DO UPDATE SET reason=excluded.reason,banned_at=excluded.banned_at,expires_at=excluded.expires_at`,
-		b.IP, b.Reason, b.BannedAt.UTC().Format(time.RFC3339), nullableTime(b.ExpiresAt))
+	var note interface{}
+	if b.Note != "" {
+		note = b.Note
+	}
+	// An empty note keeps any note already on the ban, so automatic re-bans
+	// don't erase what an operator wrote.
+	_, err := d.conn.Exec(`INSERT INTO banned_ips(tenant_id,ip,reason,banned_at,expires_at,source,note) VALUES(?,?,?,?,?,?,?)
+		ON CONFLICT(tenant_id,ip) DO UPDATE SET reason=excluded.reason,banned_at=excluded.banned_at,
+			expires_at=excluded.expires_at,source=excluded.source,note=COALESCE(excluded.note,banned_ips.note)`,
+		d.tenant, b.IP, b.Reason, b.BannedAt.UTC().Format(time.RFC3339), nullableTime(b.ExpiresAt), b.Source, note)
 	return err
 }
 
-func (d *DB) UnbanIP(ip string) error {
-	_, err := d.conn.Exec(`DELETE FROM banned_ips WHERE ip=?`, ip)
-	return err
+// UnbanIP deletes the ban on ip and reports whether there was one.
+func (d *DB) UnbanIP(ip string) (bool, error) {
+	res, err := d.conn.Exec(`DELETE FROM banned_ips WHERE tenant_id=? AND ip=?`, d.tenant, ip)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
 }
 
 func (d *DB) ListBans() ([]Ban, error) {
-	rows, err := d.conn.Query(`SELECT ip,reason,banned_at,expires_at FROM banned_ips ORDER BY banned_at DESC`)
+	rows, err := d.conn.Query(`SELECT tenant_id,ip,reason,banned_at,expires_at,source,note FROM banned_ips
+		WHERE tenant_id=? ORDER BY banned_at DESC`, d.tenant)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	var out []Ban
-	for rows.Next() {
-		var b Ban
-		var banned, expires sql.NullString
-		if err := rows.Scan(&b.IP, &b.Reason, &banned, &expires); err != nil {
-			return nil, err
-		}
-		b.BannedAt, _ = time.Parse(time.RFC3339, banned.String)
-		if expires.Valid {
-			t, _ := time.Parse(time.RFC3339, expires.String)
-			b.ExpiresAt = &t
-		}
-		out = append(out, b)
+	return d.scanBans(rows)
+}
+
+// ListBansFiltered returns up to limit bans whose reason contains
+// reasonLike (case-insensitive), most recently banned first. An empty
+// reasonLike matches every ban and a negative limit returns every match.
+func (d *DB) ListBansFiltered(reasonLike string, limit, offset int) ([]Ban, error) {
+	pattern := "%" + escapeLike(reasonLike) + "%"
+	rows, err := d.conn.Query(`SELECT tenant_id,ip,reason,banned_at,expires_at,source,note FROM banned_ips
+		WHERE tenant_id=? AND reason LIKE ? ESCAPE '\'
+		ORDER BY banned_at DESC, ip LIMIT ? OFFSET ?`,
+		d.tenant, pattern, limit, offset)
+	if err != nil {
+		return nil, err
 	}
-	return out, rows.Err()
+	return d.scanBans(rows)
+}
+
+// ListActiveBans returns up to limit unexpired bans starting at offset,
+// most recently banned first, along with the number of rows read. Malformed
+// rows are skipped, so n, not len(bans), tells whether the page was full.
+func (d *DB) ListActiveBans(limit, offset int) (bans []Ban, n int, err error) {
+	rows, err := d.conn.Query(`SELECT tenant_id,ip,reason,banned_at,expires_at,source,note FROM banned_ips
+		WHERE tenant_id=? AND (expires_at IS NULL OR expires_at >= ?)
+		ORDER BY banned_at DESC, ip LIMIT ? OFFSET ?`,
+		d.tenant, d.clock.Now().UTC().Format(time.RFC3339), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return d.scanBanRows(rows)
 }
 
 func (d *DB) GetBan(ip string) (Ban, bool, error) {
 	var b Ban
-	var banned, expires sql.NullString
-	err := d.conn.QueryRow(`SELECT ip,reason,banned_at,expires_at FROM banned_ips WHERE ip=?`, ip).
-		Scan(&b.IP, &b.Reason, &banned, &expires)
+	var banned, expires, note sql.NullString
+	err := d.conn.QueryRow(`SELECT tenant_id,ip,reason,banned_at,expires_at,source,note FROM banned_ips
+		WHERE tenant_id=? AND ip=?`, d.tenant, ip).
+		Scan(&b.Tenant, &b.IP, &b.Reason, &banned, &expires, &b.Source, &note)
 	if errors.Is(err, sql.ErrNoRows) {
 		return Ban{}, false, nil
 	}
 	if err != nil {
 		return Ban{}, false, err
 	}
-	b.BannedAt, _ = time.Parse(time.RFC3339, banned.String)
-	if expires.Valid {
-		t, _ := time.Parse(time.RFC3339, expires.String)
-		b.ExpiresAt = &t
+	b.Note = note.String
+	if err := d.parseBanTimes(&b, banned, expires); err != nil {
+		return Ban{}, false, err
 	}
 	return b, true, nil
 }
 
-// DeleteExpiredBans removes all bans whose expires_at is in the past.
+// ReplaceBansBySource replaces every ban in this tenant created by source
+// with bans, in one transaction, so a failure leaves the old set in place.
+// IPs already banned some other way keep that ban. It returns the bans
+// inserted.
+func (d *DB) ReplaceBansBySource(source string, bans []Ban) ([]Ban, error) {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM banned_ips WHERE tenant_id=? AND source=?`, d.tenant, source); err != nil {
+		return nil, err
+	}
+	var inserted []Ban
+	for _, b := range bans {
+		res, err := tx.Exec(`INSERT INTO banned_ips(tenant_id,ip,reason,banned_at,expires_at,source) VALUES(?,?,?,?,?,?)
+			ON CONFLICT(tenant_id,ip) DO NOTHING`,
+			d.tenant, b.IP, b.Reason, b.BannedAt.UTC().Format(time.RFC3339), nullableTime(b.ExpiresAt), source)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			b.Tenant, b.Source = d.tenant, source
+			inserted = append(inserted, b)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return inserted, nil
+}
+
+// DeleteExpiredBans removes all bans whose expires_at is in the past, across
+// every tenant.
 func (d *DB) DeleteExpiredBans() (int64, error) {
 	res, err := d.conn.Exec(`DELETE FROM banned_ips WHERE expires_at IS NOT NULL AND expires_at < ?`,
-		time.Now().UTC().Format(time.RFC3339))
+		d.clock.Now().UTC().Format(time.RFC3339))
 	if err != nil {
 		return 0, err
 	}
@@ -152,6 +370,123 @@ func (d *DB) IncrementalVacuum() error {
 	return err
 }
 
+// scanBans reads every row of a banned_ips query selecting
+// tenant_id,ip,reason,banned_at,expires_at,source,note, and closes rows.
+func (d *DB) scanBans(rows *sql.Rows) ([]Ban, error) {
+	bans, _, err := d.scanBanRows(rows)
+	return bans, err
+}
+
+// scanBanRows is scanBans that also returns the number of rows read,
+// including malformed ones that were skipped.
+func (d *DB) scanBanRows(rows *sql.Rows) ([]Ban, int, error) {
+	defer rows.Close()
+	var out []Ban
+	n := 0
+	for rows.Next() {
+		n++
+		var b Ban
+		var banned, expires, note sql.NullString
+		if err := rows.Scan(&b.Tenant, &b.IP, &b.Reason, &banned, &expires, &b.Source, &note); err != nil {
+			return nil, n, err
+		}
+		b.Note = note.String
+		if err := d.parseBanTimes(&b, banned, expires); err != nil {
+			log.Printf("db: skipping malformed ban row: %v", err)
+			continue
+		}
+		out = append(out, b)
+	}
+	return out, n, rows.Err()
+}
+
+// parseBanTimes fills b's timestamps from their stored form. Unparseable
+// values are an error rather than a zero time. A banned_at in the future,
+// e.g. written by a host with a skewed clock, is clamped to now, and an
+// expires_at before banned_at is clamped to banned_at, so neither the ban's
+// age nor its length is ever negative.
+func (d *DB) parseBanTimes(b *Ban, banned, expires sql.NullString) error {
+	t, err := time.Parse(time.RFC3339, banned.String)
+	if err != nil {
+		return fmt.Errorf("ban %q: banned_at %q: %w", b.IP, banned.String, err)
+	}
+	if now := d.clock.Now(); t.After(now) {
+		t = now.UTC().Truncate(time.Second)
+	}
+	b.BannedAt = t
+	if expires.Valid {
+		e, err := time.Parse(time.RFC3339, expires.String)
+		if err != nil {
+			return fmt.Errorf("ban %q: expires_at %q: %w", b.IP, expires.String, err)
+		}
+		if e.Before(t) {
+			e = t
+		}
+		b.ExpiresAt = &e
+	}
+	return nil
+}
+
+// SaveLimiterState stores the tenant's serialized in-memory limiter state,
+// replacing any earlier snapshot.
+func (d *DB) SaveLimiterState(state []byte) error {
+	_, err := d.conn.Exec(`INSERT INTO limiter_state(tenant_id,state,saved_at) VALUES(?,?,?)
+		ON CONFLICT(tenant_id) DO UPDATE SET state=excluded.state,saved_at=excluded.saved_at`,
+		d.tenant, string(state), d.clock.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// LoadLimiterState returns the tenant's last saved limiter state, if any.
+func (d *DB) LoadLimiterState() ([]byte, bool, error) {
+	var state string
+	err := d.conn.QueryRow(`SELECT state FROM limiter_state WHERE tenant_id=?`, d.tenant).Scan(&state)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return []byte(state), true, nil
+}
+
+// SoftListIP adds ip (an address or CIDR) to the tenant's soft list, whose
+// members are throttled at most and never banned.
+func (d *DB) SoftListIP(ip string) error {
+	_, err := d.conn.Exec(`INSERT INTO soft_listed_ips(tenant_id,ip,added_at) VALUES(?,?,?)
+		ON CONFLICT(tenant_id,ip) DO NOTHING`, d.tenant, ip, d.clock.Now().UTC().Format(time.RFC3339))
+	return err
+}
+
+// UnsoftListIP removes ip from the tenant's soft list.
+func (d *DB) UnsoftListIP(ip string) error {
+	_, err := d.conn.Exec(`DELETE FROM soft_listed_ips WHERE tenant_id=? AND ip=?`, d.tenant, ip)
+	return err
+}
+
+// ListSoftListed returns the tenant's soft-listed addresses and CIDRs.
+func (d *DB) ListSoftListed() ([]string, error) {
+	rows, err := d.conn.Query(`SELECT ip FROM soft_listed_ips WHERE tenant_id=? ORDER BY ip`, d.tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var ip string
+		if err := rows.Scan(&ip); err != nil {
+			return nil, err
+		}
+		out = append(out, ip)
+	}
+	return out, rows.Err()
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally.
+func escapeLike(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(s)
+}
+
 func nullableTime(t *time.Time) any {
 	if t == nil {
 		return nil
@@ -0,0 +1,49 @@
+package db
+
+import "time"
+
+// DecisionEvent is a FLAG, THROTTLE or BAN decision stored for
+// CountDecisions.
+type DecisionEvent struct {
+	Tenant string
+	Action string
+	IP     string
+	At     time.Time
+}
+
+// RecordDecisions stores events, which may belong to any tenant, in one
+// transaction.
+func (d *DB) RecordDecisions(events []DecisionEvent) error {
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if _, err := tx.Exec(`INSERT INTO decision_events(tenant_id,action,ip,at) VALUES(?,?,?,?)`,
+			e.Tenant, e.Action, e.IP, e.At.UTC().Format(time.RFC3339)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CountDecisions returns how many decisions with action the tenant recorded
+// in [since, until], to the second. An empty action counts every action.
+func (d *DB) CountDecisions(action string, since, until time.Time) (int, error) {
+	var n int
+	err := d.conn.QueryRow(`SELECT COUNT(*) FROM decision_events
+		WHERE tenant_id=? AND (?='' OR action=?) AND at >= ? AND at <= ?`,
+		d.tenant, action, action, since.UTC().Format(time.RFC3339), until.UTC().Format(time.RFC3339)).Scan(&n)
+	return n, err
+}
+
+// DeleteDecisionsBefore removes decision events recorded before t, across
+// every tenant.
+func (d *DB) DeleteDecisionsBefore(t time.Time) (int64, error) {
+	res, err := d.conn.Exec(`DELETE FROM decision_events WHERE at < ?`, t.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
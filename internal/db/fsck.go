@@ -0,0 +1,92 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// FsckReport is the result of Fsck.
+type FsckReport struct {
+	Integrity     []string // problems from PRAGMA integrity_check; empty when ok
+	ExpiredBans   int      // bans past expires_at still stored
+	MalformedBans int      // bans with unparseable timestamps
+	Fixed         bool     // expired and malformed bans were deleted
+}
+
+// OK reports whether Fsck found nothing wrong.
+func (r FsckReport) OK() bool {
+	return len(r.Integrity) == 0 && r.ExpiredBans == 0 && r.MalformedBans == 0
+}
+
+// Fsck checks the database across every tenant: it runs PRAGMA
+// integrity_check and looks for expired bans that cleanup has not removed and
+// bans whose timestamps cannot be parsed. With fix, those bans are deleted;
+// integrity problems are only reported.
+func (d *DB) Fsck(fix bool) (FsckReport, error) {
+	var rep FsckReport
+	rows, err := d.conn.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		if msg != "ok" {
+			rep.Integrity = append(rep.Integrity, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	type banKey struct{ tenant, ip string }
+	var malformed []banKey
+	now := d.clock.Now().Truncate(time.Second) // matches DeleteExpiredBans
+	rows, err = d.conn.Query(`SELECT tenant_id,ip,banned_at,expires_at FROM banned_ips`)
+	if err != nil {
+		return rep, err
+	}
+	for rows.Next() {
+		var k banKey
+		var banned string
+		var expires sql.NullString
+		if err := rows.Scan(&k.tenant, &k.ip, &banned, &expires); err != nil {
+			rows.Close()
+			return rep, err
+		}
+		_, err := time.Parse(time.RFC3339, banned)
+		var exp time.Time
+		if err == nil && expires.Valid {
+			exp, err = time.Parse(time.RFC3339, expires.String)
+		}
+		switch {
+		case err != nil:
+			rep.MalformedBans++
+			malformed = append(malformed, k)
+		case expires.Valid && exp.Before(now):
+			rep.ExpiredBans++
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return rep, err
+	}
+
+	if !fix || rep.ExpiredBans+rep.MalformedBans == 0 {
+		return rep, nil
+	}
+	for _, k := range malformed {
+		if _, err := d.conn.Exec(`DELETE FROM banned_ips WHERE tenant_id=? AND ip=?`, k.tenant, k.ip); err != nil {
+			return rep, err
+		}
+	}
+	if _, err := d.DeleteExpiredBans(); err != nil {
+		return rep, err
+	}
+	rep.Fixed = true
+	return rep, nil
+}
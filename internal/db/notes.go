@@ -0,0 +1,53 @@
+package db
+
+import "time"
+
+// IPNote is a free-form operator note attached to an IP, independent of
+// whether the IP is banned.
+type IPNote struct {
+	ID        int64
+	IP        string
+	Note      string
+	Author    string
+	CreatedAt time.Time
+}
+
+// AddIPNote stores n for the tenant and returns it with its ID and, when
+// unset, CreatedAt filled in.
+func (d *DB) AddIPNote(n IPNote) (IPNote, error) {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = d.clock.Now()
+	}
+	n.CreatedAt = n.CreatedAt.UTC().Truncate(time.Second) // as stored
+	res, err := d.conn.Exec(`INSERT INTO ip_notes(tenant_id,ip,note,author,created_at) VALUES(?,?,?,?,?)`,
+		d.tenant, n.IP, n.Note, n.Author, n.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return IPNote{}, err
+	}
+	n.ID, err = res.LastInsertId()
+	return n, err
+}
+
+// ListIPNotes returns the tenant's notes on ip, oldest first. An empty ip
+// lists the notes on every IP.
+func (d *DB) ListIPNotes(ip string) ([]IPNote, error) {
+	rows, err := d.conn.Query(`SELECT id,ip,note,author,created_at FROM ip_notes
+		WHERE tenant_id=? AND (?='' OR ip=?) ORDER BY created_at, id`, d.tenant, ip, ip)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []IPNote
+	for rows.Next() {
+		var n IPNote
+		var at string
+		if err := rows.Scan(&n.ID, &n.IP, &n.Note, &n.Author, &at); err != nil {
+			return nil, err
+		}
+		if n.CreatedAt, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,55 @@
+package db
+
+import "time"
+
+// StatsSample is a snapshot of a tenant's limiter statistics, recorded
+// periodically for trend graphs.
+type StatsSample struct {
+	At             time.Time
+	ActiveBans     int
+	FlaggedIPs     int
+	TrackedIPs     int
+	RecentRequests int
+}
+
+// RecordStatsSample stores s for the tenant.
+func (d *DB) RecordStatsSample(s StatsSample) error {
+	_, err := d.conn.Exec(`INSERT INTO stats_samples(tenant_id,at,active_bans,flagged_ips,tracked_ips,recent_requests)
+		VALUES(?,?,?,?,?,?)`,
+		d.tenant, s.At.UTC().Format(time.RFC3339), s.ActiveBans, s.FlaggedIPs, s.TrackedIPs, s.RecentRequests)
+	return err
+}
+
+// ListStatsSamples returns the tenant's samples taken at or after since,
+// oldest first.
+func (d *DB) ListStatsSamples(since time.Time) ([]StatsSample, error) {
+	rows, err := d.conn.Query(`SELECT at,active_bans,flagged_ips,tracked_ips,recent_requests FROM stats_samples
+		WHERE tenant_id=? AND at >= ? ORDER BY at, rowid`, d.tenant, since.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []StatsSample
+	for rows.Next() {
+		var s StatsSample
+		var at string
+		if err := rows.Scan(&at, &s.ActiveBans, &s.FlaggedIPs, &s.TrackedIPs, &s.RecentRequests); err != nil {
+			return nil, err
+		}
+		if s.At, err = time.Parse(time.RFC3339, at); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// DeleteStatsSamplesBefore removes samples taken before t, across every
+// tenant.
+func (d *DB) DeleteStatsSamplesBefore(t time.Time) (int64, error) {
+	res, err := d.conn.Exec(`DELETE FROM stats_samples WHERE at < ?`, t.UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"tower/internal/db"
+)
+
+// ipNoteView is the JSON representation of an IP note.
+type ipNoteView struct {
+	ID        int64     `json:"id"`
+	IP        string    `json:"ip"`
+	Note      string    `json:"note"`
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newIPNoteView(n db.IPNote) ipNoteView {
+	return ipNoteView{ID: n.ID, IP: n.IP, Note: n.Note, Author: n.Author, CreatedAt: n.CreatedAt}
+}
+
+// handleIPNotes lists the tenant's notes on ?ip= (every IP when omitted) on
+// GET, and adds {"ip", "note", "author"} on POST.
+func (s *Server) handleIPNotes(w http.ResponseWriter, r *http.Request) {
+	tdb := s.db.ForTenant(s.limiterFor(r).TenantName())
+	switch r.Method {
+	case http.MethodGet:
+		notes, err := tdb.ListIPNotes(r.URL.Query().Get("ip"))
+		if err != nil {
+			s.dbError(w, r, "list ip notes", err)
+			return
+		}
+		out := make([]ipNoteView, 0, len(notes))
+		for _, n := range notes {
+			out = append(out, newIPNoteView(n))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"notes": out})
+	case http.MethodPost:
+		var payload struct {
+			IP     string `json:"ip"`
+			Note   string `json:"note"`
+			Author string `json:"author"`
+		}
+		if !s.decodeBody(w, r, &payload) {
+			return
+		}
+		if net.ParseIP(payload.IP) == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "valid ip required"})
+			return
+		}
+		if strings.TrimSpace(payload.Note) == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "note required"})
+			return
+		}
+		n, err := tdb.AddIPNote(db.IPNote{IP: payload.IP, Note: payload.Note, Author: payload.Author})
+		if err != nil {
+			s.dbError(w, r, "add ip note", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newIPNoteView(n))
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleIPPage renders the admin view of one IP (?ip=): its ban status and
+// operator notes.
+func (s *Server) handleIPPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	ip := r.URL.Query().Get("ip")
+	if net.ParseIP(ip) == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "valid ip required"})
+		return
+	}
+	lim := s.limiterFor(r)
+	notes, err := s.db.ForTenant(lim.TenantName()).ListIPNotes(ip)
+	if err != nil {
+		s.dbError(w, r, "list ip notes", err)
+		return
+	}
+	status := banStatus(lim, ip)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!doctype html>\n<html><head><title>tower %s</title></head>\n<body>\n", html.EscapeString(ip))
+	fmt.Fprintf(&b, "<h1>%s</h1>\n", html.EscapeString(ip))
+	switch {
+	case !status.Banned:
+		b.WriteString("<p>not banned</p>\n")
+	case status.ExpiresAt == nil:
+		fmt.Fprintf(&b, "<p>banned permanently: %s</p>\n", html.EscapeString(status.Reason))
+	default:
+		fmt.Fprintf(&b, "<p>banned until %s: %s</p>\n", status.ExpiresAt.UTC().Format(time.RFC3339), html.EscapeString(status.Reason))
+	}
+	fmt.Fprintf(&b, "<h2>notes (%d)</h2>\n<ul>\n", len(notes))
+	for _, n := range notes {
+		fmt.Fprintf(&b, "<li>%s %s: %s</li>\n", n.CreatedAt.UTC().Format(time.RFC3339),
+			html.EscapeString(n.Author), html.EscapeString(n.Note))
+	}
+	b.WriteString("</ul>\n</body></html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
@@ -1,10 +1,26 @@
 package httpapi
 
 import (
+	"context"
+	_ "embed"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"tower/api"
+	"tower/internal/blockpage"
 	"tower/internal/config"
 	"tower/internal/db"
 	"tower/internal/logic"
@@ -15,46 +31,319 @@ type Server struct {
 	db         *db.DB
 	limiter    *logic.Limiter
 	adminToken string
+	logger     *log.Logger
+	ips        *logic.IPResolver // client IP extraction per RealIPHeader
+	basePath   string            // prefix routes were last registered under
+
+	blockedPage *template.Template // BlockedPageTemplate; nil for the default page
+
+	loadConfig func() (config.Config, error) // for /api/v1/admin/reload; nil disables it
+
+	probeMu sync.Mutex             // serializes /readyz callback probes
+	probes  map[string]probeResult // by callback URL, reused for readinessProbeTTL
+}
+
+// probeResult is a cached /readyz callback probe.
+type probeResult struct {
+	at     time.Time
+	result string
 }
 
 func NewServer(cfg config.Config, d *db.DB, lim *logic.Limiter, adminToken string) (*Server, error) {
-	return &Server{cfg: cfg, db: d, limiter: lim, adminToken: adminToken}, nil
+	s := &Server{cfg: cfg, db: d, limiter: lim, adminToken: adminToken, logger: log.Default(), ips: logic.NewIPResolver(cfg)}
+	if cfg.BlockedPageTemplate != "" {
+		tmpl, err := template.ParseFiles(cfg.BlockedPageTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("blocked page template: %w", err)
+		}
+		s.blockedPage = tmpl
+	}
+	return s, nil
 }
 
+// SetLogger replaces the logger used for server-side errors.
+func (s *Server) SetLogger(l *log.Logger) { s.logger = l }
+
+// SetConfigLoader enables POST /api/v1/admin/reload, which calls load to
+// build the new configuration, typically by re-reading the --config file.
+func (s *Server) SetConfigLoader(load func() (config.Config, error)) { s.loadConfig = load }
+
+// Handler serves tower's routes under the configured BasePath.
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/healthz", s.health)
-	mux.HandleFunc("/api/v1/inspect", s.authAPI(s.handleInspect))
-	mux.HandleFunc("/api/v1/log", s.authAPI(s.handleLog))
-	mux.HandleFunc("/api/v1/callbacks", s.authAPI(s.handleCallbacks))
+	s.RegisterRoutes(mux, s.cfg.BasePath)
 	return mux
 }
 
+// HTTPServer returns an http.Server for cfg.Addr serving Handler with the
+// configured read, write and idle timeouts and header size limit.
+func (s *Server) HTTPServer() *http.Server {
+	return &http.Server{
+		Addr:              s.cfg.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+		ReadTimeout:       s.cfg.ReadTimeout,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+		MaxHeaderBytes:    s.cfg.MaxHeaderBytes,
+	}
+}
+
+// RegisterRoutes mounts tower's routes on mux under prefix (for example
+// "/tower"), so tower can be embedded in another server. Leading and trailing
+// slashes on prefix are optional.
+func (s *Server) RegisterRoutes(mux *http.ServeMux, prefix string) {
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix = "/" + prefix
+	}
+	s.basePath = prefix
+	mux.HandleFunc(prefix+"/healthz", s.health)
+	mux.HandleFunc(prefix+"/readyz", s.ready)
+	mux.HandleFunc(prefix+"/metrics", s.handleMetrics)
+	mux.HandleFunc(prefix+"/ui/login", s.handleLogin)
+	mux.HandleFunc(prefix+"/ui/stats", s.authAPI(s.handleStatsPage))
+	mux.HandleFunc(prefix+"/ui/ip", s.authAPI(s.handleIPPage))
+	mux.HandleFunc(prefix+"/api/v1/inspect", s.authAPI(s.handleInspect))
+	mux.HandleFunc(prefix+"/api/v1/log", s.authLog(s.handleLog))
+	mux.HandleFunc(prefix+"/api/v1/ban-status", s.authAPI(s.handleBanStatus))
+	mux.HandleFunc(prefix+"/api/v1/ban-status/batch", s.authAPI(s.handleBanStatusBatch))
+	mux.HandleFunc(prefix+"/api/v1/callbacks", s.authAPI(s.handleCallbacks))
+	mux.HandleFunc(prefix+"/api/v1/admin/inspect-range", s.authAPI(s.handleInspectRange))
+	mux.HandleFunc(prefix+"/api/v1/admin/requests.csv", s.authAPI(s.handleRequestsCSV))
+	mux.HandleFunc(prefix+"/api/v1/admin/bans", s.authAPI(s.handleBans))
+	mux.HandleFunc(prefix+"/api/v1/admin/lockdown", s.authAPI(s.handleLockdown))
+	mux.HandleFunc(prefix+"/api/v1/admin/watchlist", s.authAPI(s.handleWatchlist))
+	mux.HandleFunc(prefix+"/api/v1/admin/ip-notes", s.authAPI(s.handleIPNotes))
+	mux.HandleFunc(prefix+"/api/v1/admin/decisions/count", s.authAPI(s.handleDecisionCount))
+	mux.HandleFunc(prefix+"/api/v1/admin/events", s.authAPI(s.handleEvents))
+	mux.HandleFunc(prefix+"/api/v1/admin/stats/samples", s.authAPI(s.handleStatsSamples))
+	mux.HandleFunc(prefix+"/api/v1/admin/config", s.authAPI(s.handleConfig))
+	mux.HandleFunc(prefix+"/api/v1/admin/reload", s.authAPI(s.handleReload))
+	mux.HandleFunc(prefix+"/api/v1/openapi.json", s.handleOpenAPI)
+	mux.HandleFunc(prefix+"/api/", notFound)
+}
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves the hand-maintained OpenAPI 3 description of the API.
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
+
 func (s *Server) health(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	_, _ = w.Write([]byte("ok"))
 }
 
-// authAPI authenticates API requests using the X-Tower-Key header.
+// handleMetrics serves latency histograms and the pending ban write count in
+// the Prometheus text format. Like the health checks it needs no credentials,
+// so scrapers can reach it; it reveals only timings and counts.
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	s.limiter.WriteMetrics(w)
+}
+
+// readinessProbeTimeout bounds each callback probe made by /readyz.
+const readinessProbeTimeout = 2 * time.Second
+
+// readinessProbeTTL is how long /readyz reuses a callback probe result, so
+// unauthenticated callers cannot make tower send a request per hit.
+const readinessProbeTTL = 10 * time.Second
+
+// ready reports whether the server can do useful work. With
+// ReadinessChecksCallbacks enabled it probes every registered callback, at
+// most once per readinessProbeTTL each, and answers 503 "degraded" when none
+// of them responds.
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	resp := map[string]interface{}{"status": "ok", "pending_ban_writes": s.limiter.PendingBanWrites()}
+	if !s.cfg.ReadinessChecksCallbacks {
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	urls := s.limiter.AllCallbacks()
+	results := s.probeCallbacks(urls)
+
+	checks := map[string]string{}
+	reachable := 0
+	for i, u := range urls {
+		checks[u] = results[i]
+		if results[i] == "ok" {
+			reachable++
+		}
+	}
+	resp["callbacks"] = checks
+	if len(urls) > 0 && reachable == 0 {
+		resp["status"] = "degraded"
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// probeCallbacks returns the probe result for each of urls, probing only
+// those without a result from the last readinessProbeTTL. Probes are not
+// tied to the request context, so a caller hanging up cannot cache a failure.
+func (s *Server) probeCallbacks(urls []string) []string {
+	s.probeMu.Lock()
+	defer s.probeMu.Unlock()
+	now := s.limiter.Now()
+	fresh := make(map[string]probeResult, len(urls))
+	results := make([]string, len(urls))
+	var wg sync.WaitGroup
+	for i, u := range urls {
+		if p, ok := s.probes[u]; ok && now.Sub(p.at) < readinessProbeTTL {
+			results[i] = p.result
+			fresh[u] = p
+			continue
+		}
+		wg.Add(1)
+		go func(i int, u string) {
+			defer wg.Done()
+			results[i] = s.probeCallback(context.Background(), u)
+		}(i, u)
+	}
+	wg.Wait()
+	for i, u := range urls {
+		if _, ok := fresh[u]; !ok {
+			fresh[u] = probeResult{at: now, result: results[i]}
+		}
+	}
+	// Keep only registered URLs, so unregistered ones do not linger.
+	s.probes = fresh
+	return results
+}
+
+// probeCallback sends a HEAD request to url and returns "ok" if any HTTP
+// response arrives, or the error text otherwise. It goes through the
+// limiter's callback client, so CallbackBlockPrivate applies to probes too.
+func (s *Server) probeCallback(ctx context.Context, url string) string {
+	ctx, cancel := context.WithTimeout(ctx, readinessProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return err.Error()
+	}
+	resp, err := s.limiter.CallbackClient().Do(req)
+	if err != nil {
+		return err.Error()
+	}
+	resp.Body.Close()
+	return "ok"
+}
+
+// maxAuthHeaderLen bounds X-Tower-Key and X-Tower-Tenant; real values are far
+// shorter.
+const maxAuthHeaderLen = 256
+
+// authAPI authenticates API requests using the X-Tower-Key header, an admin
+// session cookie obtained from /ui/login, or a signed, expiring ?access= link
+// minted by `tower ui-link`. Callers over MaxConcurrentPerIP, counted by
+// connection address (or client IP from TrustedProxies), are rejected
+// with 429 before authentication, and banned callers with 403 after it.
+// ?pretty=true indents JSON responses.
 func (s *Server) authAPI(next http.HandlerFunc) http.HandlerFunc {
+	return s.authenticate(next, true)
+}
+
+// authLog is authAPI for /api/v1/log, which leaves the caller ban check to
+// handleLog: a log forwarded on behalf of a client names a source, and only
+// the client IP it logs is subject to bans, not the forwarding proxy.
+func (s *Server) authLog(next http.HandlerFunc) http.HandlerFunc {
+	return s.authenticate(next, false)
+}
+
+func (s *Server) authenticate(next http.HandlerFunc, checkBan bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+			w = prettyWriter{w}
+		}
+		if !s.requireHTTPS(w, r) {
+			return
+		}
+		// Count the slot against the connection, not a header any
+		// unauthenticated peer could set.
+		ip := s.ips.ConnIP(r)
+		release, ok := s.limiter.BeginRequest(ip)
+		if !ok {
+			s.blockedResponse(w, r, http.StatusTooManyRequests,
+				logic.Decision{Action: logic.ActionThrottle, IP: ip, Reason: "too many concurrent requests"},
+				map[string]string{"error": "too many concurrent requests"})
+			return
+		}
+		defer release()
+		// Reject absurd credentials before comparing them or creating a
+		// tenant limiter, which touches the database.
+		if len(r.Header.Get("X-Tower-Key")) > maxAuthHeaderLen || len(r.Header.Get("X-Tower-Tenant")) > maxAuthHeaderLen {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "auth header too long"})
+			return
+		}
 		key := r.Header.Get("X-Tower-Key")
-		if key == "" || key != s.adminToken {
+		if (key == "" || key != s.adminToken) && !s.validSession(r) && !s.validAccessLink(r) {
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid api key"})
 			return
 		}
-		ip := logic.ClientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
-		if banned, b := s.limiter.IsBanned(ip); banned {
-			writeJSON(w, http.StatusForbidden, map[string]string{"error": "ip banned", "reason": b.Reason})
+		if checkBan && s.callerBanned(w, r) {
 			return
 		}
 		next(w, r)
 	}
 }
 
+// callerBanned writes a 403 and reports true when the connecting client's IP
+// is banned.
+func (s *Server) callerBanned(w http.ResponseWriter, r *http.Request) bool {
+	ip := s.ips.ClientIP(r)
+	banned, b := s.limiterFor(r).IsBanned(ip)
+	if !banned {
+		return false
+	}
+	d := logic.Decision{Action: logic.ActionBan, IP: ip, Reason: b.Reason}
+	if b.ExpiresAt != nil {
+		now := s.limiter.Now()
+		d.RetryAfter = int(math.Ceil(b.ExpiresAt.Sub(now).Seconds()))
+		s.setRetryAfter(w, now, d.RetryAfter)
+	}
+	s.blockedResponse(w, r, http.StatusForbidden, d, map[string]string{"error": "ip banned", "reason": b.Reason})
+	return true
+}
+
+// blockedResponse answers a blocked request with an HTML page or plain text
+// describing d when its Accept header prefers them, and with jsonBody
+// otherwise, so browsers see a readable page instead of raw JSON.
+func (s *Server) blockedResponse(w http.ResponseWriter, r *http.Request, status int, d logic.Decision, jsonBody interface{}) {
+	if blockpage.Write(w, r, status, d, s.blockedPage) {
+		return
+	}
+	writeJSON(w, status, jsonBody)
+}
+
+// requireHTTPS rejects r with 403 when RequireHTTPS is set and r did not
+// arrive over HTTPS, and reports whether the request may proceed.
+func (s *Server) requireHTTPS(w http.ResponseWriter, r *http.Request) bool {
+	if !s.cfg.RequireHTTPS || s.ips.Secure(r) {
+		return true
+	}
+	writeJSON(w, http.StatusForbidden, map[string]string{"error": "https required"})
+	return false
+}
+
+// limiterFor returns the tenant-scoped limiter for a request. The tenant is
+// taken from the X-Tower-Tenant header; requests without it use the default
+// tenant.
+func (s *Server) limiterFor(r *http.Request) *logic.Limiter {
+	return s.limiter.Tenant(r.Header.Get("X-Tower-Tenant"))
+}
+
 func (s *Server) handleInspect(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodGet {
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
 		return
 	}
 	var ip string
@@ -62,94 +351,651 @@ func (s *Server) handleInspect(w http.ResponseWriter, r *http.Request) {
 		var payload struct {
 			IP string `json:"ip"`
 		}
-		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if !s.decodeBody(w, r, &payload) {
+			return
+		}
 		ip = payload.IP
 	}
 	if ip == "" {
 		ip = r.URL.Query().Get("ip")
 	}
 	if ip == "" {
-		ip = logic.ClientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
+		ip = s.ips.ClientIP(r)
 	}
-	decision := s.limiter.Inspect(ip)
+	decision := s.limiterFor(r).Inspect(ip)
 	writeJSON(w, http.StatusOK, decision)
 }
 
+// handleBanStatus reports whether ?ip= (default: the caller) is banned and
+// how long the ban has left, so clients can show "try again in X".
+func (s *Server) handleBanStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	ip := r.URL.Query().Get("ip")
+	if ip == "" {
+		ip = s.ips.ClientIP(r)
+	}
+	writeJSON(w, http.StatusOK, banStatus(s.limiterFor(r), ip))
+}
+
+// handleBanStatusBatch reports the ban status of up to api.MaxBanStatusBatch
+// IPs at once, keyed by IP, for gateways checking many clients per call.
+func (s *Server) handleBanStatusBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var payload struct {
+		IPs []string `json:"ips"`
+	}
+	if !s.decodeBody(w, r, &payload) {
+		return
+	}
+	if len(payload.IPs) == 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ips required"})
+		return
+	}
+	if len(payload.IPs) > api.MaxBanStatusBatch {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d ips per batch", api.MaxBanStatusBatch)})
+		return
+	}
+	lim := s.limiterFor(r)
+	statuses := make(map[string]api.BanStatus, len(payload.IPs))
+	for _, ip := range payload.IPs {
+		ip = strings.TrimSpace(ip)
+		if _, ok := statuses[ip]; ok || ip == "" {
+			continue
+		}
+		statuses[ip] = banStatus(lim, ip)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// banStatus looks ip up in lim's ban cache, falling back to the database when
+// the cache is capped.
+func banStatus(lim *logic.Limiter, ip string) api.BanStatus {
+	status := api.BanStatus{IP: ip}
+	if banned, b := lim.IsBanned(ip); banned {
+		status.Banned = true
+		status.Reason = b.Reason
+		status.SecondsRemaining = -1
+		if b.ExpiresAt != nil {
+			status.ExpiresAt = b.ExpiresAt
+			status.SecondsRemaining = int(math.Ceil(b.ExpiresAt.Sub(lim.Now()).Seconds()))
+		}
+	}
+	return status
+}
+
+func (s *Server) handleInspectRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	var payload struct {
+		CIDR string `json:"cidr"`
+	}
+	if !s.decodeBody(w, r, &payload) {
+		return
+	}
+	_, cidr, err := net.ParseCIDR(payload.CIDR)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "valid cidr required"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.limiterFor(r).InspectRange(cidr))
+}
+
+// banView is the JSON representation of a ban.
+type banView struct {
+	IP        string     `json:"ip"`
+	Reason    string     `json:"reason"`
+	Source    string     `json:"source,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	BannedAt  time.Time  `json:"banned_at"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func newBanView(b db.Ban) banView {
+	return banView{IP: b.IP, Reason: b.Reason, Source: b.Source, Note: b.Note, BannedAt: b.BannedAt, ExpiresAt: b.ExpiresAt}
+}
+
+// handleBans lists persisted bans for the tenant, optionally filtered by a
+// ?reason= substring and paged with ?limit= (1-1000, default 100) and ?offset=.
+func (s *Server) handleBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	q := r.URL.Query()
+	limit := queryInt(q.Get("limit"), 100, 1, 1000)
+	offset := queryInt(q.Get("offset"), 0, 0, math.MaxInt32)
+	bans, err := s.db.ForTenant(s.limiterFor(r).TenantName()).ListBansFiltered(q.Get("reason"), limit, offset)
+	if err != nil {
+		s.dbError(w, r, "list bans", err)
+		return
+	}
+	out := make([]banView, 0, len(bans))
+	for _, b := range bans {
+		out = append(out, newBanView(b))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"bans": out, "limit": limit, "offset": offset})
+}
+
+// queryInt parses v as an int, returning def when it is empty or invalid and
+// clamping the result to [min, max].
+func queryInt(v string, def, min, max int) int {
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	if n < min {
+		return min
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// handleRequestsCSV streams the in-memory recent request log as CSV,
+// optionally limited to entries at or after ?since= (RFC 3339).
+func (s *Server) handleRequestsCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	var since time.Time
+	if v := r.URL.Query().Get("since"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be RFC 3339"})
+			return
+		}
+		since = t
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="requests.csv"`)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "ip", "user", "method", "path", "action", "latency_us", "raw_path", "body"})
+	for i, req := range s.limiterFor(r).RecentRequests() {
+		if req.Time.Before(since) {
+			continue
+		}
+		_ = cw.Write([]string{req.Time.UTC().Format(time.RFC3339Nano), req.IP, req.User, req.Method, req.Path,
+			string(req.Action), strconv.FormatInt(req.Latency.Microseconds(), 10), req.RawPath, req.Body})
+		if i%500 == 0 {
+			cw.Flush()
+		}
+	}
+	cw.Flush()
+}
+
 func (s *Server) handleLog(w http.ResponseWriter, r *http.Request) {
 	var payload struct {
 		IP     string `json:"ip"`
 		Method string `json:"method"`
 		Path   string `json:"path"`
+		User   string `json:"user"`
+		Weight int    `json:"weight"`
+		Status int    `json:"status"`
+		Body   string `json:"body"`
+
+		UserAgent string `json:"user_agent"`
+		Source    string `json:"source"`
 	}
-	_ = json.NewDecoder(r.Body).Decode(&payload)
-	ip := payload.IP
-	if ip == "" {
-		ip = logic.ClientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
+	if !s.decodeBody(w, r, &payload) {
+		return
 	}
-	method := payload.Method
-	if method == "" {
-		method = r.Method
+	// Fields missing from the body may come from X-Tower-Log-* headers, so
+	// edge proxies can log with an empty body.
+	source := firstNonEmpty(payload.Source, r.Header.Get("X-Tower-Log-Source"))
+	// With a source, the caller is a proxy logging on behalf of ip: it is
+	// authenticated but neither ban-checked nor logged as the subject.
+	if source == "" && s.callerBanned(w, r) {
+		return
 	}
-	p := payload.Path
-	if p == "" {
-		p = r.URL.Path
+	if payload.Weight < 0 || payload.Weight > logic.MaxWeight {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("weight must be between 0 and %d", logic.MaxWeight)})
+		return
 	}
+	ip := firstNonEmpty(payload.IP, r.Header.Get("X-Tower-Log-IP"))
+	if ip == "" && source != "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "ip required with source"})
+		return
+	}
+	if ip == "" {
+		ip = s.ips.ClientIP(r)
+	} else if net.ParseIP(ip) == nil {
+		// Arbitrary strings would otherwise be tracked and banned like IPs.
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error": map[string]string{"code": "INVALID_IP", "message": "ip is not a valid IP address"},
+		})
+		return
+	}
+	method := firstNonEmpty(payload.Method, r.Header.Get("X-Tower-Log-Method"), r.Method)
+	p := firstNonEmpty(payload.Path, r.Header.Get("X-Tower-Log-Path"), r.URL.Path)
 
-	decision := s.limiter.LogRequest(logic.RequestLog{
-		Time:   time.Now(),
+	lim := s.limiterFor(r)
+	if source != "" {
+		// The subject stands in for the caller in the ban check.
+		if banned, b := lim.IsBanned(ip); banned {
+			d := logic.Decision{Action: logic.ActionBan, IP: ip, Reason: b.Reason}
+			s.blockedResponse(w, r, http.StatusForbidden, d, d)
+			return
+		}
+	}
+	decision := lim.Evaluate(r.Context(), logic.RequestLog{
+		Time:   lim.Now(),
 		IP:     ip,
 		Method: method,
 		Path:   p,
+		User:   payload.User,
+		Weight: payload.Weight,
+		Status: payload.Status,
+		Body:   payload.Body,
+
+		UserAgent: firstNonEmpty(payload.UserAgent, r.Header.Get("X-Tower-Log-User-Agent")),
+		Source:    source,
 	})
 
-	if decision.Action == logic.ActionBan {
-		_, _ = s.limiter.RecordBan(ip, decision.Reason)
-		s.limiter.NotifyCallbacks(decision)
-		writeJSON(w, http.StatusForbidden, decision)
-		return
-	}
-	if decision.Action == logic.ActionThrottle {
-		s.limiter.NotifyCallbacks(decision)
-		writeJSON(w, http.StatusTooManyRequests, decision)
-		return
-	}
-	if decision.Action == logic.ActionFlag {
-		s.limiter.NotifyCallbacks(decision)
+	switch decision.Action {
+	case logic.ActionBan:
+		s.blockedResponse(w, r, http.StatusForbidden, decision, decision)
+	case logic.ActionThrottle:
+		s.setRetryAfter(w, lim.Now(), decision.RetryAfter)
+		s.blockedResponse(w, r, http.StatusTooManyRequests, decision, decision)
+	case logic.ActionFlag:
+		w.Header().Set("X-Tower-Flagged", "true")
+		status := s.cfg.FlagStatusCode
+		if status == 0 {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, decision)
+	default:
+		writeJSON(w, http.StatusOK, decision)
 	}
-	writeJSON(w, http.StatusOK, decision)
 }
 
 func (s *Server) handleCallbacks(w http.ResponseWriter, r *http.Request) {
+	lim := s.limiterFor(r)
 	switch r.Method {
 	case http.MethodGet:
-		writeJSON(w, http.StatusOK, map[string]interface{}{"callbacks": s.limiter.Callbacks()})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"callbacks": lim.Callbacks()})
 	case http.MethodPost:
 		var payload struct {
 			URL string `json:"url"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.URL == "" {
+		if !s.decodeBody(w, r, &payload) {
+			return
+		}
+		if payload.URL == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "url required"})
 			return
 		}
-		s.limiter.RegisterCallback(payload.URL)
+		if err := lim.RegisterCallback(payload.URL); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
 		writeJSON(w, http.StatusOK, map[string]string{"status": "registered"})
 	case http.MethodDelete:
 		var payload struct {
 			URL string `json:"url"`
 		}
-		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || payload.URL == "" {
+		if !s.decodeBody(w, r, &payload) {
+			return
+		}
+		if payload.URL == "" {
 			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "url required"})
 			return
 		}
-		s.limiter.UnregisterCallback(payload.URL)
+		lim.UnregisterCallback(payload.URL)
 		writeJSON(w, http.StatusOK, map[string]string{"status": "unregistered"})
 	default:
-		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
+
+// handleWatchlist lists the tenant's currently flagged and throttled IPs.
+func (s *Server) handleWatchlist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	lim := s.limiterFor(r)
+	writeJSON(w, http.StatusOK, map[string][]string{
+		"flagged":   lim.FlaggedIPs(),
+		"throttled": lim.ThrottledIPs(),
+	})
+}
+
+// handleDecisionCount reports how many decisions of ?action= (FLAG, THROTTLE
+// or BAN; empty for all) were recorded between ?since= and ?until=. Both
+// accept RFC 3339 or a duration before now such as "24h"; until defaults to
+// now and since is required.
+func (s *Server) handleDecisionCount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	lim := s.limiterFor(r)
+	now := lim.Now()
+	q := r.URL.Query()
+	since, ok := parseTimeParam(q.Get("since"), now)
+	if !ok || q.Get("since") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be RFC 3339 or a duration like 24h"})
+		return
+	}
+	until := now
+	if v := q.Get("until"); v != "" {
+		if until, ok = parseTimeParam(v, now); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "until must be RFC 3339 or a duration like 1h"})
+			return
+		}
+	}
+	action := strings.ToUpper(q.Get("action"))
+	n, err := lim.CountDecisions(logic.Action(action), since, until)
+	if err != nil {
+		s.dbError(w, r, "count decisions", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"action": action,
+		"since":  since.UTC(),
+		"until":  until.UTC(),
+		"count":  n,
+	})
+}
+
+// eventKeepAlive is how often handleEvents writes an SSE comment so proxies
+// keep an idle stream open.
+const eventKeepAlive = 15 * time.Second
+
+// handleEvents streams every decision, for all tenants, as Server-Sent Events
+// ("event: decision" with an api.DecisionEvent as data) until the client
+// disconnects. Events are dropped for clients that fall behind.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{}) // the stream outlives WriteTimeout
+
+	events, unsubscribe := s.limiter.SubscribeDecisions()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if rc.Flush() != nil {
+		return
 	}
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, _ = io.WriteString(w, ": keep-alive\n\n")
+		case ev := <-events:
+			_, _ = fmt.Fprintf(w, "event: decision\ndata: %s\n\n", ev)
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// parseTimeParam parses v as RFC 3339 or as a duration before now.
+func parseTimeParam(v string, now time.Time) (time.Time, bool) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(-d), true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, err == nil
+}
+
+// handleConfig returns the limits and modes clients may adapt to. Secrets,
+// URLs and paths are left out.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	c := s.limiter.Config() // reflects reloads
+	seconds := func(d time.Duration) int { return int(d / time.Second) }
+	escalation := string(c.Escalation)
+	if escalation == "" {
+		escalation = string(config.EscalationFull)
+	}
+	retryAfter := c.RetryAfterFormat
+	if retryAfter == "" {
+		retryAfter = config.RetryAfterSeconds
+	}
+	rateKey := c.RateLimitKey
+	if rateKey == "" {
+		rateKey = "{ip}"
+	}
+	flagStatus := c.FlagStatusCode
+	if flagStatus == 0 {
+		flagStatus = http.StatusOK
+	}
+	writeJSON(w, http.StatusOK, api.ServerConfig{
+		RequestLimit:              c.RequestLimit,
+		RequestWindowSeconds:      seconds(c.RequestWindow),
+		BurstGrace:                c.BurstGrace,
+		RateLimitKey:              rateKey,
+		Escalation:                escalation,
+		ThrottleLimit:             c.ThrottleLimit,
+		ThrottleWindowSeconds:     seconds(c.ThrottleWindow),
+		BanDurationSeconds:        seconds(c.BanDuration),
+		RetryAfterFormat:          retryAfter,
+		FlagStatusCode:            flagStatus,
+		ErrorStatusLimit:          c.ErrorStatusLimit,
+		ErrorStatusWindowSeconds:  seconds(c.ErrorStatusWindow),
+		DistinctPathThreshold:     c.DistinctPathThreshold,
+		DistinctPathWindowSeconds: seconds(c.DistinctPathWindow),
+		BannedMethods:             nonNil(c.BannedMethods),
+		UncountedMethods:          nonNil(c.UncountedMethods),
+		MaxConcurrentPerIP:        c.MaxConcurrentPerIP,
+		MaxBodyBytes:              c.MaxBodyBytes,
+		StartupGracePeriodSeconds: seconds(c.StartupGracePeriod),
+		Lockdown:                  s.limiter.Lockdown(),
+	})
+}
+
+// handleReload re-reads the configuration and applies its limits, windows
+// and modes to the running limiter, keeping counters, flags and bans. A
+// config that also changes settings needing a restart, such as addr or
+// data_dir, is rejected with 400 and nothing is applied.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if s.loadConfig == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "server was not started with a config file"})
+		return
+	}
+	cfg, err := s.loadConfig()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "config: " + err.Error()})
+		return
+	}
+	cfg.AdminToken = s.cfg.AdminToken // generated, never in the file
+	applied, restart := s.limiter.Reload(cfg)
+	if len(restart) > 0 {
+		keys := fileKeys(restart)
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":            "restart required to change " + strings.Join(keys, ", "),
+			"restart_required": keys,
+		})
+		return
+	}
+	if len(applied) > 0 {
+		s.logger.Printf("config reloaded: %s", strings.Join(fileKeys(applied), ", "))
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"applied": fileKeys(applied)})
+}
+
+// fileKeys maps Config field names to their config file keys.
+func fileKeys(fields []string) []string {
+	out := make([]string, 0, len(fields))
+	for _, f := range fields {
+		out = append(out, config.FileKey(f))
+	}
+	return out
+}
+
+// nonNil returns ss, or an empty slice for nil so it encodes as [].
+func nonNil(ss []string) []string {
+	if ss == nil {
+		return []string{}
+	}
+	return ss
+}
+
+// handleLockdown reports (GET) or toggles (POST {"enabled": bool}) the
+// global lockdown mode.
+func (s *Server) handleLockdown(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var payload struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if !s.decodeBody(w, r, &payload) {
+			return
+		}
+		if payload.Enabled == nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "enabled required"})
+			return
+		}
+		if err := s.limiter.SetLockdown(*payload.Enabled); err != nil {
+			s.dbError(w, r, "set lockdown", err)
+			return
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": s.limiter.Lockdown()})
+}
+
+// decodeBody decodes an optional JSON request body into v, capped at
+// MaxBodyBytes and BodyReadTimeout. An empty body leaves v untouched so
+// handlers can fall back to defaults. On a malformed, oversized or too slow
+// body it writes a 400, 413 or 408 and returns false.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if s.cfg.MaxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, s.cfg.MaxBodyBytes)
+	}
+	if s.cfg.BodyReadTimeout > 0 {
+		// A connection read deadline, unlike a context, also interrupts a
+		// Read that is already blocked on a slow client.
+		rc := http.NewResponseController(w)
+		if rc.SetReadDeadline(time.Now().Add(s.cfg.BodyReadTimeout)) == nil {
+			defer rc.SetReadDeadline(time.Time{})
+		}
+	}
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil || errors.Is(err, io.EOF) {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "body too large"})
+		return false
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		writeJSON(w, http.StatusRequestTimeout, map[string]string{"error": "timed out reading body"})
+		return false
+	}
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid json: " + err.Error()})
+	return false
+}
+
+func firstNonEmpty(vs ...string) string {
+	for _, v := range vs {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// setRetryAfter sets the Retry-After header to seconds from now, formatted
+// per RetryAfterFormat as delta-seconds or an HTTP-date. Non-positive values
+// are omitted.
+func (s *Server) setRetryAfter(w http.ResponseWriter, now time.Time, seconds int) {
+	if seconds <= 0 {
+		return
+	}
+	if s.cfg.RetryAfterFormat == config.RetryAfterHTTPDate {
+		w.Header().Set("Retry-After", now.Add(time.Duration(seconds)*time.Second).UTC().Format(http.TimeFormat))
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+}
+
+// dbError logs err under a request id and answers 500 with the stable code
+// DB_ERROR and that id, so operators can correlate the response with the log
+// without the raw database error reaching the client.
+func (s *Server) dbError(w http.ResponseWriter, r *http.Request, op string, err error) {
+	id := requestID(r)
+	s.logger.Printf("request_id=%s op=%q db error: %v", id, op, err)
+	w.Header().Set("X-Request-Id", id)
+	writeJSON(w, http.StatusInternalServerError, map[string]interface{}{
+		"error": map[string]string{"code": "DB_ERROR", "message": op + " failed", "request_id": id},
+	})
+}
+
+// requestID returns the caller's X-Request-Id, or a new random id.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get("X-Request-Id"); id != "" && len(id) <= 128 {
+		return id
+	}
+	id, err := config.NewToken(8)
+	if err != nil {
+		return "unknown"
+	}
+	return id
+}
+
+// notFound answers unknown API paths with a JSON error instead of the
+// default plain-text 404.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusNotFound, map[string]interface{}{
+		"error": map[string]string{"code": "NOT_FOUND", "message": "no route for " + r.URL.Path},
+	})
+}
+
+// methodNotAllowed writes a JSON 405 with an Allow header listing allowed.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
 }
 
 func writeJSON(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(v)
+	enc := json.NewEncoder(w)
+	if _, ok := w.(prettyWriter); ok {
+		enc.SetIndent("", "  ")
+	}
+	_ = enc.Encode(v)
+}
+
+// prettyWriter marks a response whose JSON writeJSON should indent, for
+// requests with ?pretty=true.
+type prettyWriter struct {
+	http.ResponseWriter
 }
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (p prettyWriter) Unwrap() http.ResponseWriter { return p.ResponseWriter }
@@ -0,0 +1,147 @@
+package httpapi
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AdminPasswordSetting is the settings key holding the bcrypt hash of the
+	// optional admin password.
+	AdminPasswordSetting = "admin_password_hash"
+
+	sessionCookie = "tower_session"
+	sessionTTL    = 12 * time.Hour
+)
+
+const loginForm = `<!doctype html>
+<html><head><title>tower login</title></head>
+<body>
+<form method="post">
+<label>Admin password <input type="password" name="password" autofocus></label>
+<button type="submit">Log in</button>
+</form>
+</body></html>
+`
+
+// HashAdminPassword returns the bcrypt hash stored for an admin password.
+func HashAdminPassword(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(h), nil
+}
+
+// handleLogin serves a minimal login form and, on POST, verifies the admin
+// password and sets a signed session cookie accepted in place of the token.
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !s.requireHTTPS(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(loginForm))
+	case http.MethodPost:
+		hash, ok, err := s.db.GetSetting(AdminPasswordSetting)
+		if err != nil {
+			s.dbError(w, r, "read admin password", err)
+			return
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "admin password not set"})
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(r.FormValue("password"))) != nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid password"})
+			return
+		}
+		exp := s.limiter.Now().Add(sessionTTL)
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    s.signSession(exp),
+			Path:     s.basePath + "/",
+			Expires:  exp,
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		writeJSON(w, http.StatusOK, map[string]string{"status": "logged in"})
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// signSession returns "<unix expiry>.<hmac>" keyed by the admin token, so
+// rotating the token invalidates every session.
+func (s *Server) signSession(exp time.Time) string {
+	ts := strconv.FormatInt(exp.Unix(), 10)
+	return ts + "." + s.sessionMAC(ts)
+}
+
+func (s *Server) sessionMAC(ts string) string {
+	mac := hmac.New(sha256.New, []byte(s.adminToken))
+	mac.Write([]byte(ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validSession reports whether r carries an unexpired, correctly signed
+// session cookie.
+func (s *Server) validSession(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return false
+	}
+	ts, sig, ok := strings.Cut(c.Value, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sessionMAC(ts))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	return s.limiter.Now().Before(time.Unix(unix, 0))
+}
+
+// AccessLinkParam is the query parameter carrying a signed access link token.
+const AccessLinkParam = "access"
+
+// SignAccessLink returns a token for AccessLinkParam that authenticates admin
+// requests until exp. It is an HMAC keyed by the admin token over the expiry,
+// so it carries no secret and rotating the token revokes every link.
+func SignAccessLink(adminToken string, exp time.Time) string {
+	ts := strconv.FormatInt(exp.Unix(), 10)
+	return ts + "." + accessLinkMAC(adminToken, ts)
+}
+
+func accessLinkMAC(adminToken, ts string) string {
+	mac := hmac.New(sha256.New, []byte(adminToken))
+	mac.Write([]byte("access-link:" + ts)) // domain-separated from session cookies
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validAccessLink reports whether r is a GET carrying an unexpired, correctly
+// signed access link token. Links only grant read access: they end up in
+// browser history, so they never authorize changes such as lockdown.
+func (s *Server) validAccessLink(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	v := r.URL.Query().Get(AccessLinkParam)
+	ts, sig, ok := strings.Cut(v, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(accessLinkMAC(s.adminToken, ts))) {
+		return false
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	return s.limiter.Now().Before(time.Unix(unix, 0))
+}
@@ -0,0 +1,117 @@
+package httpapi
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"tower/internal/db"
+)
+
+// statsSampleView is the JSON representation of a stats sample.
+type statsSampleView struct {
+	At             time.Time `json:"at"`
+	ActiveBans     int       `json:"active_bans"`
+	FlaggedIPs     int       `json:"flagged_ips"`
+	TrackedIPs     int       `json:"tracked_ips"`
+	RecentRequests int       `json:"recent_requests"`
+}
+
+// statsSamples returns the tenant's samples since the since query parameter
+// (a duration or RFC 3339 time, 24h by default), writing an error response
+// and returning false on failure.
+func (s *Server) statsSamples(w http.ResponseWriter, r *http.Request) ([]db.StatsSample, bool) {
+	lim := s.limiterFor(r)
+	since := lim.Now().Add(-24 * time.Hour)
+	if v := r.URL.Query().Get("since"); v != "" {
+		var ok bool
+		if since, ok = parseTimeParam(v, lim.Now()); !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "since must be RFC 3339 or a duration like 24h"})
+			return nil, false
+		}
+	}
+	samples, err := lim.StatsSamples(since)
+	if err != nil {
+		s.dbError(w, r, "list stats samples", err)
+		return nil, false
+	}
+	return samples, true
+}
+
+// handleStatsSamples lists recorded stats samples, oldest first.
+func (s *Server) handleStatsSamples(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	samples, ok := s.statsSamples(w, r)
+	if !ok {
+		return
+	}
+	out := make([]statsSampleView, 0, len(samples))
+	for _, smp := range samples {
+		out = append(out, statsSampleView(smp))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"samples": out})
+}
+
+// handleStatsPage renders sparklines of the recorded stats samples.
+func (s *Server) handleStatsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	samples, ok := s.statsSamples(w, r)
+	if !ok {
+		return
+	}
+	series := []struct {
+		name  string
+		value func(db.StatsSample) int
+	}{
+		{"active bans", func(s db.StatsSample) int { return s.ActiveBans }},
+		{"flagged IPs", func(s db.StatsSample) int { return s.FlaggedIPs }},
+		{"tracked IPs", func(s db.StatsSample) int { return s.TrackedIPs }},
+	}
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<html><head><title>tower stats</title></head>\n<body>\n")
+	fmt.Fprintf(&b, "<p>%d samples</p>\n", len(samples))
+	for _, sr := range series {
+		values := make([]int, len(samples))
+		for i, smp := range samples {
+			values[i] = sr.value(smp)
+		}
+		last := 0
+		if len(values) > 0 {
+			last = values[len(values)-1]
+		}
+		fmt.Fprintf(&b, "<p>%s: %d<br>%s</p>\n", sr.name, last, sparkline(values))
+	}
+	b.WriteString("</body></html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// Sparkline dimensions in pixels.
+const sparkWidth, sparkHeight = 300, 40
+
+// sparkline renders values as an inline SVG polyline scaled to the largest
+// value.
+func sparkline(values []int) string {
+	peak := 1
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) * sparkWidth / float64(len(values)-1)
+		}
+		y := sparkHeight - float64(v)*sparkHeight/float64(peak)
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return fmt.Sprintf(`<svg width="%d" height="%d"><polyline fill="none" stroke="currentColor" points="%s"/></svg>`,
+		sparkWidth, sparkHeight, strings.Join(points, " "))
+}
@@ -0,0 +1,125 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"tower/internal/db"
+)
+
+// banRetryInterval is how often queued ban writes are retried.
+const banRetryInterval = 500 * time.Millisecond
+
+// banQueue holds automatic bans whose database write failed. The bans are
+// already enforced from the cache; the queue retries persisting them in the
+// background until the write succeeds, the ban is lifted, it expires or the
+// queue is closed.
+type banQueue struct {
+	mu       sync.Mutex
+	pending  map[banKey]pendingBan
+	retrying bool
+	closed   bool
+	done     chan struct{} // closed by close to stop the retry loop
+}
+
+type banKey struct{ tenant, ip string }
+
+type pendingBan struct {
+	db  *db.DB
+	ban db.Ban
+}
+
+func newBanQueue() *banQueue {
+	return &banQueue{pending: map[banKey]pendingBan{}, done: make(chan struct{})}
+}
+
+// add queues b for d, replacing any earlier pending write for the same IP,
+// and starts the retry loop if it is not running. Nothing is retried once the
+// queue is closed.
+func (q *banQueue) add(d *db.DB, b db.Ban) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending[banKey{d.Tenant(), b.IP}] = pendingBan{db: d, ban: b}
+	if !q.retrying && !q.closed {
+		q.retrying = true
+		go q.retry()
+	}
+}
+
+// drop forgets any pending write for ip in tenant, e.g. after an unban.
+func (q *banQueue) drop(tenant, ip string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.pending, banKey{tenant, ip})
+}
+
+func (q *banQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// close stops the retry loop, e.g. before the database is closed. Pending
+// writes are abandoned.
+func (q *banQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
+
+// retry writes pending bans every banRetryInterval until none are left or
+// the queue is closed.
+func (q *banQueue) retry() {
+	ticker := time.NewTicker(banRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		q.mu.Lock()
+		batch := make(map[banKey]pendingBan, len(q.pending))
+		for k, p := range q.pending {
+			batch[k] = p
+		}
+		q.mu.Unlock()
+
+		for k, p := range batch {
+			expired := p.ban.ExpiresAt != nil && p.db.Clock().Now().After(*p.ban.ExpiresAt)
+			if !expired && p.db.BanIP(p.ban) != nil {
+				continue
+			}
+			q.mu.Lock()
+			// Keep a newer write queued for the same IP meanwhile.
+			if cur, ok := q.pending[k]; ok && cur.ban.BannedAt.Equal(p.ban.BannedAt) {
+				delete(q.pending, k)
+			}
+			q.mu.Unlock()
+		}
+
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.retrying = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// PendingBanWrites returns how many automatic bans, across all tenants, are
+// enforced from memory while their database write is being retried.
+func (l *Limiter) PendingBanWrites() int {
+	return l.banQueue.len()
+}
+
+// Close stops retrying pending ban writes and writes out buffered decisions,
+// for every tenant. Call it before closing the database.
+func (l *Limiter) Close() {
+	l.banQueue.close()
+	l.decisionQueue.close()
+}
@@ -0,0 +1,133 @@
+package logic
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"tower/internal/db"
+)
+
+// blocklistReason is the ban reason recorded for imported entries.
+const blocklistReason = "blocklist import"
+
+// StartBlocklistRefresh imports BlocklistURL immediately and then every
+// BlocklistRefreshInterval until ctx is cancelled. It is a no-op when no URL
+// is configured.
+func (l *Limiter) StartBlocklistRefresh(ctx context.Context) {
+	if l.cfg.BlocklistURL == "" {
+		return
+	}
+	interval := l.cfg.BlocklistRefreshInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	go func() {
+		_, _ = l.RefreshBlocklist(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, _ = l.RefreshBlocklist(ctx)
+			}
+		}
+	}()
+}
+
+// RefreshBlocklist fetches BlocklistURL and replaces every ban previously
+// imported from it with the current entries. Entries that are already banned
+// manually or automatically are left alone. It returns the number of
+// imported bans.
+func (l *Limiter) RefreshBlocklist(ctx context.Context) (int, error) {
+	entries, err := fetchBlocklist(ctx, l.cfg.BlocklistURL)
+	if err != nil {
+		return 0, err
+	}
+
+	// Rewrite the stored bans first, in one transaction and without l.mu,
+	// so a large import neither stalls Evaluate nor is left half-applied;
+	// the cache is swapped in one step afterwards.
+	now := l.clock.Now()
+	bans := make([]db.Ban, 0, len(entries))
+	for _, entry := range entries {
+		bans = append(bans, db.Ban{IP: entry, Reason: blocklistReason, BannedAt: now})
+	}
+	inserted, err := l.db.ReplaceBansBySource(db.SourceBlocklist, bans)
+	if err != nil {
+		return 0, err
+	}
+	return l.swapBlocklistCache(inserted), nil
+}
+
+// swapBlocklistCache replaces the cached blocklist bans with bans, leaving
+// entries that were banned some other way in the meantime alone. It returns
+// the number of bans cached.
+func (l *Limiter) swapBlocklistCache(bans []db.Ban) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.bannedCache {
+		if b.Source == db.SourceBlocklist {
+			l.uncacheBanLocked(key)
+		}
+	}
+	n := 0
+	for _, b := range bans {
+		if _, exists := l.bannedCache[b.IP]; exists {
+			continue
+		}
+		l.cacheBanLocked(b)
+		n++
+	}
+	return n
+}
+
+// fetchBlocklist downloads and parses a newline-separated list of IPs and
+// CIDR ranges. Blank lines, "#" comments and invalid entries are skipped.
+func fetchBlocklist(ctx context.Context, url string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("blocklist: unexpected status %s", resp.Status)
+	}
+
+	seen := make(map[string]bool)
+	var out []string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		if _, n, err := net.ParseCIDR(line); err == nil {
+			line = n.String()
+		} else if ip := net.ParseIP(line); ip != nil {
+			line = ip.String()
+		} else {
+			continue
+		}
+		if !seen[line] {
+			seen[line] = true
+			out = append(out, line)
+		}
+	}
+	return out, sc.Err()
+}
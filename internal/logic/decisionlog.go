@@ -0,0 +1,56 @@
+package logic
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"tower/api"
+)
+
+// decisionLogBuffer is the number of events queued for the writer before new
+// events are dropped, so a slow log consumer never blocks the request path.
+const decisionLogBuffer = 1024
+
+// decisionEvent is one line of the decision log.
+type decisionEvent = api.DecisionEvent
+
+// decisionLog writes decision events as single-line JSON from a background
+// goroutine. It is shared by a limiter and all of its tenants.
+type decisionLog struct {
+	ch chan []byte
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newDecisionLog(w io.Writer) *decisionLog {
+	dl := &decisionLog{ch: make(chan []byte, decisionLogBuffer), w: w}
+	go dl.run()
+	return dl
+}
+
+func (dl *decisionLog) run() {
+	for line := range dl.ch {
+		dl.mu.Lock()
+		_, _ = dl.w.Write(line)
+		dl.mu.Unlock()
+	}
+}
+
+// emit queues ev, dropping it if the buffer is full.
+func (dl *decisionLog) emit(ev decisionEvent) {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	select {
+	case dl.ch <- append(line, '\n'):
+	default:
+	}
+}
+
+func (dl *decisionLog) setWriter(w io.Writer) {
+	dl.mu.Lock()
+	dl.w = w
+	dl.mu.Unlock()
+}
@@ -0,0 +1,93 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"tower/internal/db"
+)
+
+// decisionFlushInterval is how often recorded decisions are written out.
+const decisionFlushInterval = time.Second
+
+// maxPendingDecisions bounds the decisions buffered between flushes; past it
+// new ones are dropped rather than growing memory while the database lags.
+const maxPendingDecisions = 10000
+
+// decisionQueue buffers decisions recorded for DecisionRetention and writes
+// them in one transaction per flush, so the request path never waits on the
+// database.
+type decisionQueue struct {
+	mu       sync.Mutex
+	db       *db.DB
+	pending  []db.DecisionEvent
+	flushing bool
+	closed   bool
+	done     chan struct{} // closed by close to stop the flush loop
+}
+
+func newDecisionQueue(d *db.DB) *decisionQueue {
+	return &decisionQueue{db: d, done: make(chan struct{})}
+}
+
+// add buffers e and starts the flush loop if it is not running.
+func (q *decisionQueue) add(e db.DecisionEvent) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || len(q.pending) >= maxPendingDecisions {
+		return
+	}
+	q.pending = append(q.pending, e)
+	if !q.flushing {
+		q.flushing = true
+		go q.loop()
+	}
+}
+
+// flush writes every buffered decision now.
+func (q *decisionQueue) flush() error {
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return q.db.RecordDecisions(batch)
+}
+
+// close writes what is buffered and stops the flush loop, e.g. before the
+// database is closed.
+func (q *decisionQueue) close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.done)
+	q.mu.Unlock()
+	_ = q.flush()
+}
+
+// loop flushes every decisionFlushInterval until nothing is left or the
+// queue is closed.
+func (q *decisionQueue) loop() {
+	ticker := time.NewTicker(decisionFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+		}
+		_ = q.flush()
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.flushing = false
+			q.mu.Unlock()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
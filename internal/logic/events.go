@@ -0,0 +1,64 @@
+package logic
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// eventSubscriberBuffer is the number of events queued per subscriber before
+// further events are dropped for it.
+const eventSubscriberBuffer = 256
+
+// eventHub fans decision events out to live subscribers such as
+// /api/v1/admin/events. It is shared by a limiter and all of its tenants.
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan []byte]struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: map[chan []byte]struct{}{}}
+}
+
+func (h *eventHub) active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs) > 0
+}
+
+// publish sends ev as JSON to every subscriber without blocking; slow
+// subscribers miss events rather than delaying requests.
+func (h *eventHub) publish(ev decisionEvent) {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- line:
+		default:
+		}
+	}
+}
+
+// SubscribeDecisions returns a channel receiving every decision made by this
+// limiter and its tenants, JSON-encoded as api.DecisionEvent, and a func that
+// unsubscribes and closes the channel.
+func (l *Limiter) SubscribeDecisions() (<-chan []byte, func()) {
+	ch := make(chan []byte, eventSubscriberBuffer)
+	h := l.events
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package logic
+
+import "sync"
+
+// inFlight counts requests currently being served per IP, for
+// MaxConcurrentPerIP.
+type inFlight struct {
+	mu   sync.Mutex
+	byIP map[string]int
+}
+
+// BeginRequest records the start of a request from ip. It reports false,
+// recording nothing, when ip already has MaxConcurrentPerIP requests in
+// flight; otherwise the caller must call the returned release func once the
+// request finishes. A MaxConcurrentPerIP of 0 disables the limit.
+func (l *Limiter) BeginRequest(ip string) (release func(), ok bool) {
+	max := l.cfg.MaxConcurrentPerIP
+	if max <= 0 {
+		return func() {}, true
+	}
+	f := l.inFlight
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.byIP[ip] >= max {
+		return nil, false
+	}
+	f.byIP[ip]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			f.mu.Lock()
+			defer f.mu.Unlock()
+			if f.byIP[ip]--; f.byIP[ip] <= 0 {
+				delete(f.byIP, ip)
+			}
+		})
+	}, true
+}
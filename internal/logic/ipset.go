@@ -0,0 +1,44 @@
+package logic
+
+import "net"
+
+// ipSet matches addresses against a list of exact IPs and CIDR ranges.
+type ipSet struct {
+	ips  map[string]bool
+	nets []*net.IPNet
+}
+
+func newIPSet(entries []string) ipSet {
+	s := ipSet{ips: map[string]bool{}}
+	for _, entry := range entries {
+		if _, n, err := net.ParseCIDR(entry); err == nil {
+			s.nets = append(s.nets, n)
+		} else {
+			s.ips[entry] = true
+		}
+	}
+	return s
+}
+
+func (s ipSet) contains(ip string) bool {
+	if s.ips[ip] {
+		return true
+	}
+	if len(s.nets) == 0 {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range s.nets {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s ipSet) empty() bool {
+	return len(s.ips) == 0 && len(s.nets) == 0
+}
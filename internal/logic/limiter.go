@@ -4,64 +4,310 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"tower/api"
+	"tower/internal/clock"
 	"tower/internal/config"
 	"tower/internal/db"
 )
 
 // Action represents the escalation decision for an IP.
-type Action string
+type Action = api.Action
 
 const (
-	ActionAllow    Action = "ALLOW"
-	ActionFlag     Action = "FLAG"
-	ActionThrottle Action = "THROTTLE"
-	ActionBan      Action = "BAN"
+	ActionAllow    = api.ActionAllow
+	ActionFlag     = api.ActionFlag
+	ActionThrottle = api.ActionThrottle
+	ActionBan      = api.ActionBan
+	ActionUnban    = api.ActionUnban
 )
 
-// Decision is the result of inspecting or logging a request.
-type Decision struct {
-	Action     Action `json:"action"`
-	IP         string `json:"ip"`
-	Reason     string `json:"reason,omitempty"`
-	RetryAfter int    `json:"retry_after,omitempty"` // seconds
-}
+// Decision is the result of inspecting or logging a request. It is the
+// canonical api.Decision that the server serializes and the SDK decodes.
+type Decision = api.Decision
 
 type RequestLog struct {
 	Time   time.Time
 	IP     string
 	Method string
 	Path   string
+	Weight int // cost counted toward the request limit; 0 is treated as 1, and at most MaxWeight is counted
+	Status int // response status reported by the caller; 0 when unknown
+
+	// Request body excerpt; only the first LogBodyBytes bytes are kept.
+	Body string
+
+	// Application user the request belongs to, for RateLimitKey's {user}.
+	User string
+
+	// User-Agent of the logged request, checked against BannedUserAgents.
+	UserAgent string
+
+	// Source identifies the proxy that forwarded the log on behalf of IP;
+	// empty when the client logged its own request.
+	Source string
+
+	// Set by Evaluate when NormalizePaths rewrote Path: the path as received.
+	RawPath string
+
+	// Set by Evaluate on the copy kept in RecentRequests.
+	Action  Action        // final decision for the request
+	Latency time.Duration // time taken to reach the decision
+}
+
+// hit is a weighted request timestamp in the sliding request window.
+type hit struct {
+	at     time.Time
+	weight int
+}
+
+// window holds the hits tracked under one RateLimitKey, all from ip.
+type window struct {
+	ip   string
+	hits []hit
 }
 
 type Limiter struct {
-	cfg config.Config
-	db  *db.DB
+	cfg    config.Config
+	db     *db.DB
+	tenant string
+	clock  clock.Clock
 
 	mu             sync.Mutex
-	reqByIP        map[string][]time.Time
+	reqByKey       map[string]*window   // by RateLimitKey
 	flaggedIPs     map[string]time.Time // first-time suspicious behavior
 	throttleByIP   map[string][]time.Time
+	errorsByIP     map[string][]time.Time          // 4xx responses, for ErrorStatusLimit
+	pathsByIP      map[string]map[string]time.Time // path last seen, for DistinctPathThreshold
+	lastViolation  map[string]time.Time            // most recent over-limit request, for GoodBehaviorWindow
 	bannedCache    map[string]db.Ban
+	bannedNets     map[string]*net.IPNet // CIDR bans in bannedCache, by key
+	bansCapped     bool                  // LoadBans hit MaxCachedBans; misses consult the DB
 	recentRequests []RequestLog
 	callbacks      []string // callback URLs
+
+	notified map[notifyKey]time.Time // last callback per IP and action, for CallbackDedupWindow
+
+	tenantMu sync.Mutex
+	tenants  map[string]*Limiter // per-tenant limiters, only set on the root
+
+	// Tenant use, guarded by the root's tenantMu. On the root useSeq counts
+	// Tenant lookups; on a tenant it is the count at its last lookup, which
+	// orders eviction even when lastUsed times tie.
+	useSeq   uint64
+	lastUsed time.Time
+
+	softList *softList
+
+	*shared
 }
 
 func NewLimiter(cfg config.Config, d *db.DB) *Limiter {
+	sh := &shared{
+		startedAt:      d.Clock().Now(),
+		lockdown:       newLockdown(d, cfg.LockdownAllowlist),
+		callbackClient: newCallbackClient(cfg),
+		inFlight:       &inFlight{byIP: map[string]int{}},
+		banQueue:       newBanQueue(),
+		decisionQueue:  newDecisionQueue(d),
+		events:         newEventHub(),
+		uaBanned:       compileValidUserAgents(cfg.BannedUserAgents),
+		uaAllowed:      compileValidUserAgents(cfg.AllowedUserAgents),
+		metrics:        newMetrics(cfg.MetricsBuckets),
+	}
+	if cfg.DecisionLogEnabled {
+		sh.decisions = newDecisionLog(os.Stdout)
+	}
+	return newLimiter(cfg, d, sh)
+}
+
+// shared is the state a root limiter hands down to its tenant limiters.
+type shared struct {
+	startedAt      time.Time      // for StartupGracePeriod
+	decisions      *decisionLog   // nil unless DecisionLogEnabled
+	lockdown       *lockdown      // global kill switch
+	callbackClient *http.Client   // reused for every callback delivery
+	inFlight       *inFlight      // concurrent requests per IP, across tenants
+	banQueue       *banQueue      // automatic bans awaiting a database retry
+	decisionQueue  *decisionQueue // decisions awaiting a batched write, for DecisionRetention
+	events         *eventHub      // live decision subscribers
+	uaBanned       []*regexp.Regexp
+	uaAllowed      []*regexp.Regexp
+	metrics        *metrics // latency histograms for /metrics
+}
+
+// newCallbackClient builds the HTTP client used to deliver callbacks. It keeps
+// idle connections per host so bursts of events to one receiver reuse them.
+// With CallbackBlockPrivate it refuses to connect to private addresses, checked
+// after DNS resolution so hostnames and rebinding cannot get around it.
+func newCallbackClient(cfg config.Config) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.ForceAttemptHTTP2 = true
+	if cfg.CallbackBlockPrivate {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: dialPublicOnly}
+		tr.DialContext = dialer.DialContext
+	}
+	if cfg.CallbackIdleConns > 0 {
+		tr.MaxIdleConnsPerHost = cfg.CallbackIdleConns
+		if tr.MaxIdleConns < cfg.CallbackIdleConns {
+			tr.MaxIdleConns = cfg.CallbackIdleConns
+		}
+	}
+	timeout := cfg.CallbackTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &http.Client{Transport: tr, Timeout: timeout}
+}
+
+func newLimiter(cfg config.Config, d *db.DB, sh *shared) *Limiter {
 	return &Limiter{
 		cfg:            cfg,
 		db:             d,
-		reqByIP:        make(map[string][]time.Time),
+		tenant:         d.Tenant(),
+		clock:          d.Clock(),
+		reqByKey:       make(map[string]*window),
 		flaggedIPs:     make(map[string]time.Time),
 		throttleByIP:   make(map[string][]time.Time),
+		errorsByIP:     make(map[string][]time.Time),
+		pathsByIP:      make(map[string]map[string]time.Time),
+		lastViolation:  make(map[string]time.Time),
+		notified:       make(map[notifyKey]time.Time),
 		bannedCache:    make(map[string]db.Ban),
+		bannedNets:     make(map[string]*net.IPNet),
 		recentRequests: make([]RequestLog, 0, cfg.InMemoryLogLimit),
+		tenants:        make(map[string]*Limiter),
+		softList:       newSoftList(d),
+		shared:         sh,
+	}
+}
+
+// Tenant returns the limiter for the named tenant, creating it and loading
+// its persisted bans and snapshot state on first use. Each tenant has its own
+// request counters, flags, throttles, bans and callbacks. The empty string is
+// the default tenant and returns the root limiter itself. At most MaxTenants
+// tenant limiters are kept; past that the least recently used one without
+// callbacks is evicted.
+func (l *Limiter) Tenant(name string) *Limiter {
+	if name == l.tenant || l.tenants == nil {
+		return l
+	}
+	l.tenantMu.Lock()
+	defer l.tenantMu.Unlock()
+	now := l.clock.Now()
+	l.useSeq++
+	if t, ok := l.tenants[name]; ok {
+		t.useSeq, t.lastUsed = l.useSeq, now
+		return t
+	}
+	if max := l.cfg.MaxTenants; max > 0 && len(l.tenants) >= max {
+		l.evictTenantLocked()
 	}
+	t := newLimiter(l.Config(), l.db.ForTenant(name), l.shared)
+	t.tenants = nil
+	t.useSeq, t.lastUsed = l.useSeq, now
+	_ = t.LoadBans()
+	_ = t.Restore()
+	l.tenants[name] = t
+	return t
+}
+
+// evictTenantLocked drops the least recently used tenant limiter that has no
+// callbacks, saving its escalation state first so it is restored when the
+// tenant comes back. The caller must hold l.tenantMu.
+func (l *Limiter) evictTenantLocked() {
+	var oldest *Limiter
+	for _, t := range l.tenants {
+		if t.hasCallbacks() {
+			continue
+		}
+		if oldest == nil || t.useSeq < oldest.useSeq {
+			oldest = t
+		}
+	}
+	if oldest != nil {
+		l.dropTenantLocked(oldest)
+	}
+}
+
+// expireTenants drops tenant limiters without callbacks that have not been
+// used within TenantIdleTimeout.
+func (l *Limiter) expireTenants() {
+	if l.cfg.TenantIdleTimeout <= 0 {
+		return
+	}
+	cutoff := l.clock.Now().Add(-l.cfg.TenantIdleTimeout)
+	l.tenantMu.Lock()
+	defer l.tenantMu.Unlock()
+	for _, t := range l.tenants {
+		if t.lastUsed.Before(cutoff) && !t.hasCallbacks() {
+			l.dropTenantLocked(t)
+		}
+	}
+}
+
+// dropTenantLocked snapshots t and removes it from l.tenants. Its bans stay
+// in the database. The caller must hold l.tenantMu.
+func (l *Limiter) dropTenantLocked(t *Limiter) {
+	_ = t.snapshot()
+	delete(l.tenants, t.tenant)
+}
+
+func (l *Limiter) hasCallbacks() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.callbacks) > 0
+}
+
+// SetClock replaces the time source for this limiter, its database handle
+// and any tenant limiters already created.
+func (l *Limiter) SetClock(c clock.Clock) {
+	for _, t := range l.tenantLimiters() {
+		t.mu.Lock()
+		t.clock = c
+		t.db.SetClock(c)
+		t.mu.Unlock()
+	}
+}
+
+// SetDecisionLogOutput redirects the decision log from stdout to w. It has no
+// effect unless DecisionLogEnabled is set.
+func (l *Limiter) SetDecisionLogOutput(w io.Writer) {
+	if l.decisions != nil {
+		l.decisions.setWriter(w)
+	}
+}
+
+// Now returns the current time according to the limiter's clock.
+func (l *Limiter) Now() time.Time { return l.clock.Now() }
+
+// TenantName returns the tenant this limiter is scoped to.
+func (l *Limiter) TenantName() string { return l.tenant }
+
+func (l *Limiter) tenantLimiters() []*Limiter {
+	out := []*Limiter{l}
+	l.tenantMu.Lock()
+	defer l.tenantMu.Unlock()
+	for _, t := range l.tenants {
+		out = append(out, t)
+	}
+	return out
 }
 
 // StartCleanup launches a background goroutine that periodically removes
@@ -89,66 +335,159 @@ func (l *Limiter) runCleanup() {
 	// 1. Delete expired bans from DB and evict from cache.
 	deleted, _ := l.db.DeleteExpiredBans()
 	if deleted > 0 {
-		l.mu.Lock()
-		for ip, b := range l.bannedCache {
-			if b.ExpiresAt != nil && time.Now().After(*b.ExpiresAt) {
-				delete(l.bannedCache, ip)
+		for _, t := range l.tenantLimiters() {
+			t.mu.Lock()
+			for ip, b := range t.bannedCache {
+				if b.ExpiresAt != nil && l.clock.Now().After(*b.ExpiresAt) {
+					t.uncacheBanLocked(ip)
+					t.notifyLocked(Decision{Action: ActionUnban, IP: ip, Reason: "ban expired"})
+				}
 			}
+			t.mu.Unlock()
 		}
-		l.mu.Unlock()
 	}
 
-	// 2. Reclaim freed disk space.
+	// 2. Drop decision events past DecisionRetention.
+	if l.cfg.DecisionRetention > 0 {
+		_, _ = l.db.DeleteDecisionsBefore(l.clock.Now().Add(-l.cfg.DecisionRetention))
+	}
+
+	// 3. Forget paths of IPs that stopped scanning, request windows with
+	// no hits left in RequestWindow and violations past GoodBehaviorWindow.
+	for _, t := range l.tenantLimiters() {
+		t.mu.Lock()
+		if l.cfg.DistinctPathThreshold > 0 {
+			t.prunePathsLocked()
+		}
+		t.pruneWindowsLocked()
+		t.pruneViolationsLocked()
+		t.mu.Unlock()
+	}
+
+	// 4. Drop tenant limiters idle past TenantIdleTimeout.
+	l.expireTenants()
+
+	// 5. Reclaim freed disk space.
 	l.db.IncrementalVacuum()
 }
 
+// loadBansPageSize is the number of bans read per query when loading the cache.
+const loadBansPageSize = 1000
+
+// LoadBans reads active bans into the in-memory cache, most recent first, in
+// pages. At most MaxCachedBans are cached; older active bans are still
+// enforced through a database lookup on cache miss.
 func (l *Limiter) LoadBans() error {
-	bans, err := l.db.ListBans()
-	if err != nil {
-		return err
-	}
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for _, b := range bans {
-		l.bannedCache[b.IP] = b
+	limit := l.cfg.MaxCachedBans
+	for offset := 0; limit <= 0 || offset < limit; offset += loadBansPageSize {
+		size := loadBansPageSize
+		if limit > 0 && offset+size > limit {
+			size = limit - offset
+		}
+		bans, n, err := l.db.ListActiveBans(size, offset)
+		if err != nil {
+			return err
+		}
+		l.mu.Lock()
+		for _, b := range bans {
+			l.cacheBanLocked(b)
+		}
+		if limit > 0 && offset+n >= limit {
+			l.bansCapped = true
+		}
+		l.mu.Unlock()
+		// Page on rows read, not bans kept: malformed rows are skipped, so
+		// a page of them must not end the load.
+		if n < size {
+			break
+		}
 	}
 	return nil
 }
 
+// cacheBanLocked adds b to the ban cache, indexing CIDR bans for range
+// lookups. The caller must hold l.mu.
+func (l *Limiter) cacheBanLocked(b db.Ban) {
+	l.bannedCache[b.IP] = b
+	if _, n, err := net.ParseCIDR(b.IP); err == nil {
+		l.bannedNets[b.IP] = n
+	}
+}
+
+// uncacheBanLocked removes the ban keyed by key from the cache. The caller
+// must hold l.mu.
+func (l *Limiter) uncacheBanLocked(key string) {
+	delete(l.bannedCache, key)
+	delete(l.bannedNets, key)
+}
+
+// banLocked returns the active ban for ip, evicting it if it has expired.
+// IPs not banned directly are matched against cached CIDR bans. When
+// LoadBans was capped by MaxCachedBans, a cache miss falls through to the
+// database.
+// The caller must hold l.mu.
+func (l *Limiter) banLocked(ip string) (db.Ban, bool) {
+	b, ok := l.bannedCache[ip]
+	if !ok && len(l.bannedNets) > 0 {
+		if parsed := net.ParseIP(ip); parsed != nil {
+			for key, n := range l.bannedNets {
+				if n.Contains(parsed) {
+					b, ok = l.bannedCache[key], true
+					ip = key
+					break
+				}
+			}
+		}
+	}
+	if !ok && l.bansCapped {
+		stored, found, err := l.db.GetBan(ip)
+		if err != nil || !found {
+			return db.Ban{}, false
+		}
+		b, ok = stored, true
+	}
+	if !ok {
+		return db.Ban{}, false
+	}
+	if b.ExpiresAt != nil && l.clock.Now().After(*b.ExpiresAt) {
+		l.uncacheBanLocked(ip)
+		_, _ = l.db.UnbanIP(ip)
+		l.notifyLocked(Decision{Action: ActionUnban, IP: ip, Reason: "ban expired"})
+		return db.Ban{}, false
+	}
+	return b, true
+}
+
 func (l *Limiter) IsBanned(ip string) (bool, db.Ban) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	b, ok := l.bannedCache[ip]
+	b, ok := l.banLocked(ip)
 	if !ok {
 		return false, db.Ban{}
 	}
-	if b.ExpiresAt != nil && time.Now().After(*b.ExpiresAt) {
-		delete(l.bannedCache, ip)
-		_ = l.db.UnbanIP(ip)
-		return false, db.Ban{}
-	}
 	return true, b
 }
 
 // Inspect checks an IP against the current state without recording a request.
 func (l *Limiter) Inspect(ip string) Decision {
+	if d, denied := l.lockdownDecision(ip); denied {
+		return d
+	}
+	if l.exempt(ip) {
+		return Decision{Action: ActionAllow, IP: ip}
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
 	// Check ban first
-	if b, ok := l.bannedCache[ip]; ok {
-		if b.ExpiresAt != nil && time.Now().After(*b.ExpiresAt) {
-			delete(l.bannedCache, ip)
-			_ = l.db.UnbanIP(ip)
-		} else {
-			return Decision{Action: ActionBan, IP: ip, Reason: b.Reason}
-		}
+	if b, ok := l.banLocked(ip); ok {
+		return Decision{Action: ActionBan, IP: ip, Reason: b.Reason}
 	}
 
 	// Check throttle state
-	throttles := prune(l.throttleByIP[ip], l.cfg.ThrottleWindow)
+	throttles := prune(l.throttleByIP[ip], l.cfg.ThrottleWindow, l.clock.Now())
 	if len(throttles) > 0 {
-		return Decision{Action: ActionThrottle, IP: ip, Reason: "rate limit exceeded", RetryAfter: int(l.cfg.RequestWindow.Seconds())}
+		return Decision{Action: ActionThrottle, IP: ip, Reason: "rate limit exceeded", RetryAfter: l.retryAfterLocked()}
 	}
 
 	// Check flagged state
@@ -159,25 +498,174 @@ func (l *Limiter) Inspect(ip string) Decision {
 	return Decision{Action: ActionAllow, IP: ip}
 }
 
+// exempt reports whether ip is a private or loopback address that
+// ExemptPrivateIPs lets through without rate limiting.
+func (l *Limiter) exempt(ip string) bool {
+	if !l.cfg.ExemptPrivateIPs {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	return parsed != nil && (parsed.IsPrivate() || parsed.IsLoopback())
+}
+
+// Evaluate is the canonical in-process entry point: it records r, returns
+// the escalation decision for its IP, persists the ban when the decision is
+// BAN and notifies registered callbacks of any non-ALLOW decision. No
+// authentication is involved, so it is intended for trusted callers that
+// embed the limiter. During lockdown, non-allowlisted IPs are denied without
+// being recorded; with ExemptPrivateIPs, private and loopback IPs are allowed
+// without being recorded. Either way the decision is still published to
+// SubscribeDecisions and the decision log. With NormalizePaths, r.Path is
+// cleaned before any of this and the original kept as RawPath.
+func (l *Limiter) Evaluate(ctx context.Context, r RequestLog) Decision {
+	defer l.metrics.evaluate.observeSince(time.Now())
+	r = l.normalizeRequestPath(r)
+	if d, denied := l.lockdownDecision(r.IP); denied {
+		l.publishDecision(r, d)
+		return d
+	}
+	if l.exempt(r.IP) {
+		d := Decision{Action: ActionAllow, IP: r.IP}
+		l.publishDecision(r, d)
+		return d
+	}
+	start := time.Now()
+	d := l.decide(ctx, r)
+	l.annotateRecent(r, d.Action, time.Since(start))
+	l.publishDecision(r, d)
+	if d.Action == ActionBan {
+		_, _ = l.RecordBan(r.IP, d.Reason)
+	}
+	if d.Action != ActionAllow && l.cfg.DecisionRetention > 0 {
+		l.decisionQueue.add(db.DecisionEvent{Tenant: l.tenant, Action: string(d.Action), IP: d.IP, At: l.clock.Now()})
+	}
+	if d.Action != ActionAllow {
+		l.NotifyCallbacks(d)
+	}
+	return d
+}
+
+// publishDecision sends d for r to live subscribers and, unless it is ALLOW,
+// to the decision log.
+func (l *Limiter) publishDecision(r RequestLog, d Decision) {
+	logged := d.Action != ActionAllow && l.decisions != nil
+	if !logged && !l.events.active() {
+		return
+	}
+	ev := decisionEvent{
+		TS:     l.clock.Now().UTC(),
+		Action: d.Action,
+		IP:     d.IP,
+		Tenant: l.tenant,
+		Method: r.Method,
+		Path:   r.Path,
+		Reason: d.Reason,
+		Code:   d.Code,
+		UserID: r.User,
+	}
+	if logged {
+		l.decisions.emit(ev)
+	}
+	l.events.publish(ev)
+}
+
+// LogRequest is Evaluate without a context: it records r, persists the ban
+// on a BAN decision and notifies callbacks.
 func (l *Limiter) LogRequest(r RequestLog) Decision {
+	return l.Evaluate(context.Background(), r)
+}
+
+// decide records r and returns the escalation decision for its IP. When a
+// decision hook is configured, non-ALLOW decisions are passed to it and may be
+// overridden. BAN decisions for soft-listed IPs are downgraded to THROTTLE.
+func (l *Limiter) decide(ctx context.Context, r RequestLog) Decision {
+	d := l.logRequest(r)
+	if d.Action != ActionAllow && l.cfg.DecisionHookURL != "" {
+		d = l.applyDecisionHook(ctx, d)
+		if l.warmingUp() && (d.Action == ActionThrottle || d.Action == ActionBan) {
+			d = Decision{Action: ActionFlag, IP: d.IP, Reason: d.Reason}
+		}
+	}
+	return l.soften(d)
+}
+
+// truncateBody cuts s to at most n bytes, backing off to a rune boundary so
+// a multi-byte character is never split.
+func truncateBody(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func (l *Limiter) logRequest(r RequestLog) Decision {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	// append to recent log
+	// append to recent log; bodies are dropped unless LogBodyBytes opts in
 	if len(l.recentRequests) >= l.cfg.InMemoryLogLimit {
 		l.recentRequests = l.recentRequests[1:]
 	}
+	r.Body = truncateBody(r.Body, l.cfg.LogBodyBytes)
 	l.recentRequests = append(l.recentRequests, r)
 
+	// Scanners announcing themselves are banned outright.
+	if l.userAgentBlocked(r.UserAgent) {
+		return l.userAgentDecisionLocked(r)
+	}
+
+	// Uncounted methods are only logged.
+	if containsFold(l.cfg.UncountedMethods, r.Method) && !containsFold(l.cfg.BannedMethods, r.Method) {
+		return Decision{Action: ActionAllow, IP: r.IP}
+	}
+
 	// rate limit check
-	l.reqByIP[r.IP] = prune(l.reqByIP[r.IP], l.cfg.RequestWindow)
-	l.reqByIP[r.IP] = append(l.reqByIP[r.IP], r.Time)
-	count := len(l.reqByIP[r.IP])
+	count := l.countLocked(r)
 
-	// Under limit: allow
-	if count <= l.cfg.RequestLimit {
+	// Disallowed methods are banned outright.
+	if containsFold(l.cfg.BannedMethods, r.Method) {
+		if l.warmingUp() {
+			return l.flagLocked(r, "disallowed method "+strings.ToUpper(r.Method))
+		}
+		return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: disallowed method " + strings.ToUpper(r.Method)}
+	}
+
+	// Touching too many distinct paths is a scan, whatever the rate.
+	if l.pathScanLocked(r) {
+		l.noteViolationLocked(r.IP)
+		return l.pathScanDecisionLocked(r)
+	}
+
+	// Under limit (plus burst grace) and not producing a 4xx storm: allow.
+	// The status is recorded even when over the limit, so a storm is still
+	// seen while the IP is being escalated.
+	storm := l.errorStormLocked(r)
+	if count <= l.cfg.RequestLimit+l.cfg.BurstGrace && !storm {
+		l.forgiveLocked(r.IP)
 		return Decision{Action: ActionAllow, IP: r.IP}
 	}
+	l.noteViolationLocked(r.IP)
+
+	// During the startup grace period violations are only flagged.
+	if l.warmingUp() {
+		return l.flagLocked(r, "suspicious activity detected")
+	}
+
+	switch l.cfg.Escalation {
+	case config.EscalationBanOnly:
+		return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: rate limit exceeded"}
+	case config.EscalationFlagOnly:
+		if _, flagged := l.flaggedIPs[r.IP]; !flagged {
+			l.flaggedIPs[r.IP] = r.Time
+		}
+		return Decision{Action: ActionFlag, IP: r.IP, Reason: "suspicious activity detected"}
+	}
 
 	// First time exceeding limit: flag
 	if _, flagged := l.flaggedIPs[r.IP]; !flagged {
@@ -185,60 +673,335 @@ func (l *Limiter) LogRequest(r RequestLog) Decision {
 		return Decision{Action: ActionFlag, IP: r.IP, Reason: "suspicious activity detected"}
 	}
 
-	// Repeated violations: throttle
-	l.throttleByIP[r.IP] = prune(l.throttleByIP[r.IP], l.cfg.ThrottleWindow)
-	l.throttleByIP[r.IP] = append(l.throttleByIP[r.IP], r.Time)
-	if len(l.throttleByIP[r.IP]) >= l.cfg.ThrottleLimit {
-		return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: repeated throttling"}
+	// Repeated violations: throttle, and ban after ThrottleLimit throttles
+	// within ThrottleWindow. Without a ThrottleWindow throttles never ban.
+	if l.cfg.ThrottleWindow > 0 {
+		l.throttleByIP[r.IP] = prune(l.throttleByIP[r.IP], l.cfg.ThrottleWindow, l.clock.Now())
+		l.throttleByIP[r.IP] = append(l.throttleByIP[r.IP], r.Time)
+		if len(l.throttleByIP[r.IP]) >= l.cfg.ThrottleLimit {
+			return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: repeated throttling"}
+		}
 	}
-	return Decision{Action: ActionThrottle, IP: r.IP, Reason: "rate limit exceeded", RetryAfter: int(l.cfg.RequestWindow.Seconds())}
+	return Decision{Action: ActionThrottle, IP: r.IP, Reason: "rate limit exceeded", RetryAfter: l.retryAfterLocked()}
 }
 
-func (l *Limiter) RecordBan(ip, reason string) (db.Ban, error) {
+// MaxWeight is the largest weight one request counts for. It is far above
+// any sane limit but keeps window totals from overflowing.
+const MaxWeight = 1 << 20
+
+// countLocked adds r to its request window and returns the window's total
+// weight. A RequestWindow of zero or less disables rate limiting: nothing is
+// tracked and the count is 0. The caller must hold l.mu.
+func (l *Limiter) countLocked(r RequestLog) int {
+	if l.cfg.RequestWindow <= 0 {
+		return 0
+	}
+	weight := min(r.Weight, MaxWeight)
+	if weight <= 0 {
+		weight = 1
+	}
+	key := l.rateKey(r)
+	win, ok := l.reqByKey[key]
+	if !ok {
+		win = &window{ip: r.IP}
+		l.reqByKey[key] = win
+	}
+	win.hits = pruneHits(win.hits, l.cfg.RequestWindow, l.clock.Now())
+	win.hits = append(win.hits, hit{at: r.Time, weight: weight})
+	count := 0
+	for _, h := range win.hits {
+		count += h.weight
+	}
+	return count
+}
+
+// pruneWindowsLocked drops request windows whose hits are all older than
+// RequestWindow, so keys built from varying paths or users do not pile up.
+// The caller must hold l.mu.
+func (l *Limiter) pruneWindowsLocked() {
+	now := l.clock.Now()
+	for key, win := range l.reqByKey {
+		if win.hits = pruneHits(win.hits, l.cfg.RequestWindow, now); len(win.hits) == 0 {
+			delete(l.reqByKey, key)
+		}
+	}
+}
+
+// retryAfter is retryAfterLocked for callers not holding l.mu.
+func (l *Limiter) retryAfter() int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	return l.retryAfterLocked()
+}
 
-	exp := time.Now().Add(l.cfg.BanDuration)
-	b := db.Ban{
+// retryAfterLocked is the RetryAfter of THROTTLE decisions: RequestWindow
+// rounded up to whole seconds, moved by a random offset within
+// ±RetryAfterJitter, and at least 1 so clients never retry immediately. The
+// caller must hold l.mu.
+func (l *Limiter) retryAfterLocked() int {
+	secs := int(math.Ceil(l.cfg.RequestWindow.Seconds()))
+	if jitter := int(math.Ceil(l.cfg.RetryAfterJitter.Seconds())); jitter > 0 {
+		secs += rand.IntN(2*jitter+1) - jitter
+	}
+	return max(secs, 1)
+}
+
+// containsFold reports whether list holds s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// warmingUp reports whether the limiter is still inside StartupGracePeriod,
+// during which enforcement is capped at FLAG.
+func (l *Limiter) warmingUp() bool {
+	return l.cfg.StartupGracePeriod > 0 && l.clock.Now().Sub(l.startedAt) < l.cfg.StartupGracePeriod
+}
+
+// flagLocked flags r.IP and returns a FLAG decision. The caller must hold l.mu.
+func (l *Limiter) flagLocked(r RequestLog, reason string) Decision {
+	if _, flagged := l.flaggedIPs[r.IP]; !flagged {
+		l.flaggedIPs[r.IP] = r.Time
+	}
+	return Decision{Action: ActionFlag, IP: r.IP, Reason: reason}
+}
+
+// forgiveLocked clears ip's throttle strikes once it has gone
+// GoodBehaviorWindow without a violation. The caller must hold l.mu.
+func (l *Limiter) forgiveLocked(ip string) {
+	last, ok := l.lastViolation[ip]
+	if !ok || l.cfg.GoodBehaviorWindow <= 0 || l.clock.Now().Sub(last) < l.cfg.GoodBehaviorWindow {
+		return
+	}
+	delete(l.throttleByIP, ip)
+	delete(l.lastViolation, ip)
+}
+
+// noteViolationLocked records now as ip's latest violation, for
+// GoodBehaviorWindow; nothing is tracked while it is 0. The caller must hold
+// l.mu.
+func (l *Limiter) noteViolationLocked(ip string) {
+	if l.cfg.GoodBehaviorWindow > 0 {
+		l.lastViolation[ip] = l.clock.Now()
+	}
+}
+
+// pruneViolationsLocked forgives every IP whose last violation is at least
+// GoodBehaviorWindow old, so IPs that went quiet are not tracked forever.
+// The caller must hold l.mu.
+func (l *Limiter) pruneViolationsLocked() {
+	now := l.clock.Now()
+	for ip, last := range l.lastViolation {
+		if l.cfg.GoodBehaviorWindow <= 0 || now.Sub(last) >= l.cfg.GoodBehaviorWindow {
+			delete(l.throttleByIP, ip)
+			delete(l.lastViolation, ip)
+		}
+	}
+}
+
+// errorStormLocked records a 4xx status for r and reports whether the IP has
+// exceeded ErrorStatusLimit within ErrorStatusWindow. The caller must hold l.mu.
+func (l *Limiter) errorStormLocked(r RequestLog) bool {
+	if l.cfg.ErrorStatusLimit <= 0 || l.cfg.ErrorStatusWindow <= 0 {
+		return false
+	}
+	errs := prune(l.errorsByIP[r.IP], l.cfg.ErrorStatusWindow, l.clock.Now())
+	if r.Status >= 400 && r.Status < 500 {
+		errs = append(errs, r.Time)
+	}
+	if len(errs) == 0 {
+		delete(l.errorsByIP, r.IP)
+		return false
+	}
+	l.errorsByIP[r.IP] = errs
+	return len(errs) > l.cfg.ErrorStatusLimit
+}
+
+// applyDecisionHook posts the tentative decision to the configured hook and
+// returns the hook's override, if any. Errors, timeouts, non-2xx responses
+// and unknown actions fail open: the tentative decision is kept.
+func (l *Limiter) applyDecisionHook(ctx context.Context, d Decision) Decision {
+	timeout := l.cfg.DecisionHookTimeout
+	if timeout <= 0 {
+		timeout = 250 * time.Millisecond
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	payload, _ := json.Marshal(d)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.cfg.DecisionHookURL, bytes.NewReader(payload))
+	if err != nil {
+		return d
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return d
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return d
+	}
+
+	var override struct {
+		Action Action `json:"action"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&override); err != nil {
+		return d
+	}
+	switch override.Action {
+	case ActionAllow, ActionFlag, ActionThrottle, ActionBan:
+	default:
+		return d
+	}
+	if override.Action == d.Action {
+		return d
+	}
+	out := Decision{Action: override.Action, IP: d.IP, Reason: override.Reason}
+	if out.Reason == "" {
+		out.Reason = "decision hook override"
+	}
+	if out.Action == ActionThrottle {
+		out.RetryAfter = l.retryAfter()
+	}
+	if out.Action == ActionAllow {
+		out.Reason = ""
+	}
+	return out
+}
+
+// RecordBan bans ip for BanDuration. If the database write fails the ban is
+// still enforced from the cache and the write is retried in the background
+// (see PendingBanWrites), so a transient database error does not let a
+// banned IP back in; queued reports that this happened. An IP that is
+// already banned keeps its existing ban, which is returned unchanged, so
+// repeated requests neither extend it nor replace a longer manual ban.
+func (l *Limiter) RecordBan(ip, reason string) (b db.Ban, queued bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.banLocked(ip); ok {
+		return b, false
+	}
+	now := l.clock.Now()
+	exp := now.Add(l.cfg.BanDuration)
+	b = db.Ban{
+		Tenant:    l.tenant,
 		IP:        ip,
 		Reason:    reason,
-		BannedAt:  time.Now(),
+		BannedAt:  now,
 		ExpiresAt: &exp,
+		Source:    db.SourceAuto,
 	}
 	if err := l.db.BanIP(b); err != nil {
-		return db.Ban{}, err
+		l.banQueue.add(l.db, b)
+		queued = true
 	}
-	l.bannedCache[ip] = b
-	return b, nil
+	l.cacheBanLocked(b)
+	return b, queued
 }
 
+// DefaultBanDuration asks RecordManualBan to pick the duration from
+// ReasonDurations by reason, falling back to BanDuration.
+const DefaultBanDuration time.Duration = -1
+
+// RecordManualBan bans ip for duration; 0 bans it permanently.
 func (l *Limiter) RecordManualBan(ip, reason string, duration time.Duration) (db.Ban, error) {
+	return l.RecordManualBanWithNote(ip, reason, "", duration)
+}
+
+// RecordManualBanWithNote is RecordManualBan with a private operator note
+// stored alongside the ban. The note is shown to admins only and never
+// included in callback payloads.
+func (l *Limiter) RecordManualBanWithNote(ip, reason, note string, duration time.Duration) (db.Ban, error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	if duration == DefaultBanDuration {
+		duration = l.reasonDuration(reason)
+	}
+	now := l.clock.Now()
 	var exp *time.Time
 	if duration > 0 {
-		t := time.Now().Add(duration)
+		t := now.Add(duration)
 		exp = &t
 	}
 	b := db.Ban{
+		Tenant:    l.tenant,
 		IP:        ip,
 		Reason:    reason,
-		BannedAt:  time.Now(),
+		BannedAt:  now,
 		ExpiresAt: exp,
+		Source:    db.SourceManual,
+		Note:      note,
 	}
 	if err := l.db.BanIP(b); err != nil {
 		return db.Ban{}, err
 	}
-	l.bannedCache[ip] = b
+	l.cacheBanLocked(b)
 	return b, nil
 }
 
+// reasonDuration returns the ReasonDurations entry with the longest prefix
+// of reason, ignoring case, or BanDuration when none matches.
+func (l *Limiter) reasonDuration(reason string) time.Duration {
+	best, d := -1, l.cfg.BanDuration
+	reason = strings.ToLower(reason)
+	for prefix, pd := range l.cfg.ReasonDurations {
+		if len(prefix) > best && strings.HasPrefix(reason, strings.ToLower(prefix)) {
+			best, d = len(prefix), pd
+		}
+	}
+	return d
+}
+
+// Unban lifts the ban on ip, notifying callbacks only when a cached or
+// stored ban was actually removed.
 func (l *Limiter) Unban(ip string) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	delete(l.bannedCache, ip)
-	return l.db.UnbanIP(ip)
+	_, cached := l.bannedCache[ip]
+	l.uncacheBanLocked(ip)
+	l.banQueue.drop(l.tenant, ip)
+	stored, err := l.db.UnbanIP(ip)
+	if err != nil {
+		return err
+	}
+	if cached || stored {
+		l.notifyLocked(Decision{Action: ActionUnban, IP: ip, Reason: "manual unban"})
+	}
+	return nil
+}
+
+// annotateRecent records the decision and its latency on r's entry in the
+// recent request log, searching from the newest entry.
+func (l *Limiter) annotateRecent(r RequestLog, action Action, latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i := len(l.recentRequests) - 1; i >= 0; i-- {
+		e := &l.recentRequests[i]
+		if e.Action == "" && e.IP == r.IP && e.Time.Equal(r.Time) && e.Path == r.Path {
+			e.Action = action
+			e.Latency = latency
+			return
+		}
+	}
+}
+
+// CountDecisions returns how many action decisions this tenant recorded
+// between since and until; an empty action counts all. Decisions are only
+// recorded while DecisionRetention is set. Decisions still buffered for
+// writing are flushed first.
+func (l *Limiter) CountDecisions(action Action, since, until time.Time) (int, error) {
+	if err := l.decisionQueue.flush(); err != nil {
+		return 0, err
+	}
+	return l.db.CountDecisions(string(action), since, until)
 }
 
 func (l *Limiter) RecentRequests() []RequestLog {
@@ -249,30 +1012,118 @@ func (l *Limiter) RecentRequests() []RequestLog {
 	return out
 }
 
-// RegisterCallback adds a URL that will be notified on security events.
-func (l *Limiter) RegisterCallback(url string) {
+// ErrTooManyCallbacks is returned by RegisterCallback when the tenant already
+// has MaxCallbacks URLs registered.
+var ErrTooManyCallbacks = errors.New("callback limit reached")
+
+// ErrInvalidCallbackURL is returned by RegisterCallback for URLs that cannot
+// be delivered to or that CallbackBlockPrivate forbids.
+var ErrInvalidCallbackURL = errors.New("invalid callback url")
+
+// canonicalCallbackURL validates raw as an absolute http(s) URL and returns
+// it with a lowercase scheme and host, no default port and no fragment, so
+// equivalent spellings dedupe. With blockPrivate, loopback, private,
+// link-local and unspecified IP literals and localhost are rejected.
+func canonicalCallbackURL(raw string, blockPrivate bool) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidCallbackURL, err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: scheme must be http or https", ErrInvalidCallbackURL)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidCallbackURL)
+	}
+	if u.User != nil {
+		return "", fmt.Errorf("%w: credentials are not allowed", ErrInvalidCallbackURL)
+	}
+	if blockPrivate {
+		ip := net.ParseIP(host)
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && privateIP(ip)) {
+			return "", fmt.Errorf("%w: private and loopback hosts are not allowed", ErrInvalidCallbackURL)
+		}
+	}
+
+	port := u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+// privateIP reports whether ip is loopback, private, link-local or
+// unspecified, which CallbackBlockPrivate forbids.
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// dialPublicOnly is a net.Dialer Control that refuses connections to
+// privateIP addresses once the callback host has been resolved.
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+		return fmt.Errorf("%w: %s resolves to a private address", ErrInvalidCallbackURL, host)
+	}
+	return nil
+}
+
+// RegisterCallback adds a URL that will be notified on security events. The
+// URL is validated and canonicalized first; registering a URL twice is a
+// no-op.
+func (l *Limiter) RegisterCallback(raw string) error {
+	target, err := canonicalCallbackURL(raw, l.cfg.CallbackBlockPrivate)
+	if err != nil {
+		return err
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	for _, u := range l.callbacks {
-		if u == url {
-			return
+		if u == target {
+			return nil
 		}
 	}
-	l.callbacks = append(l.callbacks, url)
+	if l.cfg.MaxCallbacks > 0 && len(l.callbacks) >= l.cfg.MaxCallbacks {
+		return ErrTooManyCallbacks
+	}
+	l.callbacks = append(l.callbacks, target)
+	return nil
 }
 
-// UnregisterCallback removes a callback URL.
-func (l *Limiter) UnregisterCallback(url string) {
+// UnregisterCallback removes a callback URL, matching its canonical form.
+func (l *Limiter) UnregisterCallback(raw string) {
+	target := raw
+	if canonical, err := canonicalCallbackURL(raw, false); err == nil {
+		target = canonical
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	for i, u := range l.callbacks {
-		if u == url {
+		if u == target {
 			l.callbacks = append(l.callbacks[:i], l.callbacks[i+1:]...)
 			return
 		}
 	}
 }
 
+// CallbackClient returns the HTTP client callbacks are delivered with. With
+// CallbackBlockPrivate it refuses to dial private addresses.
+func (l *Limiter) CallbackClient() *http.Client { return l.callbackClient }
+
 // Callbacks returns the registered callback URLs.
 func (l *Limiter) Callbacks() []string {
 	l.mu.Lock()
@@ -282,45 +1133,210 @@ func (l *Limiter) Callbacks() []string {
 	return out
 }
 
+// AllCallbacks returns the callback URLs registered across the default
+// tenant and every other tenant, without duplicates.
+func (l *Limiter) AllCallbacks() []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, t := range l.tenantLimiters() {
+		for _, u := range t.Callbacks() {
+			if !seen[u] {
+				seen[u] = true
+				out = append(out, u)
+			}
+		}
+	}
+	return out
+}
+
 // NotifyCallbacks sends a security event to all registered callback URLs.
 func (l *Limiter) NotifyCallbacks(d Decision) {
 	l.mu.Lock()
-	urls := make([]string, len(l.callbacks))
-	copy(urls, l.callbacks)
-	l.mu.Unlock()
+	defer l.mu.Unlock()
+	l.notifyLocked(d)
+}
 
-	if len(urls) == 0 || d.Action == ActionAllow {
+// notifyLocked is NotifyCallbacks for callers that already hold l.mu. The
+// requests are sent asynchronously.
+func (l *Limiter) notifyLocked(d Decision) {
+	if len(l.callbacks) == 0 || d.Action == ActionAllow || l.duplicateLocked(d) {
 		return
 	}
+	urls := make([]string, len(l.callbacks))
+	copy(urls, l.callbacks)
 
 	payload, _ := json.Marshal(d)
 	for _, u := range urls {
 		go func(target string) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(payload))
+			defer l.metrics.callback.observeSince(time.Now())
+			req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(payload))
 			if err != nil {
 				return
 			}
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("X-Tower-Event", string(d.Action))
-			resp, err := http.DefaultClient.Do(req)
+			resp, err := l.callbackClient.Do(req)
 			if err == nil {
+				// Drain the body so the connection returns to the pool.
+				_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
 				resp.Body.Close()
 			}
 		}(u)
 	}
 }
 
+// notifyKey identifies a callback event for deduplication.
+type notifyKey struct {
+	ip     string
+	action Action
+}
+
+// notifiedSweepSize is the number of dedup entries above which expired ones
+// are swept.
+const notifiedSweepSize = 1024
+
+// duplicateLocked reports whether the same action was already sent for d.IP
+// within CallbackDedupWindow, and otherwise records d as sent. An UNBAN
+// resets the IP so a later ban is reported again. The caller must hold l.mu.
+func (l *Limiter) duplicateLocked(d Decision) bool {
+	window := l.cfg.CallbackDedupWindow
+	if window <= 0 {
+		return false
+	}
+	now := l.clock.Now()
+	if d.Action == ActionUnban {
+		for k := range l.notified {
+			if k.ip == d.IP {
+				delete(l.notified, k)
+			}
+		}
+		return false
+	}
+	key := notifyKey{ip: d.IP, action: d.Action}
+	if last, ok := l.notified[key]; ok && now.Sub(last) < window {
+		return true
+	}
+	if len(l.notified) >= notifiedSweepSize {
+		for k, at := range l.notified {
+			if now.Sub(at) >= window {
+				delete(l.notified, k)
+			}
+		}
+	}
+	l.notified[key] = now
+	return false
+}
+
+// RangeStats aggregates limiter state for the IPs within a CIDR range.
+type RangeStats struct {
+	CIDR      string   `json:"cidr"`
+	Tracked   int      `json:"tracked"`
+	Flagged   int      `json:"flagged"`
+	Throttled int      `json:"throttled"`
+	Banned    int      `json:"banned"`
+	IPs       []string `json:"ips"`
+}
+
+// InspectRange reports how many known IPs inside cidr are tracked, flagged,
+// throttled or banned, along with the sorted list of those IPs.
+func (l *Limiter) InspectRange(cidr *net.IPNet) RangeStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	seen := make(map[string]bool)
+	in := func(ip string) bool {
+		parsed := net.ParseIP(ip)
+		if parsed == nil || !cidr.Contains(parsed) {
+			return false
+		}
+		seen[ip] = true
+		return true
+	}
+
+	st := RangeStats{CIDR: cidr.String()}
+	for ip := range l.trackedIPsLocked() {
+		if in(ip) {
+			st.Tracked++
+		}
+	}
+	for ip := range l.flaggedIPs {
+		if in(ip) {
+			st.Flagged++
+		}
+	}
+	for ip, ts := range l.throttleByIP {
+		if len(prune(ts, l.cfg.ThrottleWindow, now)) > 0 && in(ip) {
+			st.Throttled++
+		}
+	}
+	for ip, b := range l.bannedCache {
+		if b.ExpiresAt != nil && now.After(*b.ExpiresAt) {
+			continue
+		}
+		if in(ip) {
+			st.Banned++
+		}
+	}
+	st.IPs = make([]string, 0, len(seen))
+	for ip := range seen {
+		st.IPs = append(st.IPs, ip)
+	}
+	sort.Strings(st.IPs)
+	return st
+}
+
 // Stats returns current limiter statistics.
 func (l *Limiter) Stats() (activeBans, flaggedIPs, trackedIPs, recentReqs int) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	return len(l.bannedCache), len(l.flaggedIPs), len(l.reqByIP), len(l.recentRequests)
+	return len(l.bannedCache), len(l.flaggedIPs), len(l.trackedIPsLocked()), len(l.recentRequests)
 }
 
-func prune(ts []time.Time, window time.Duration) []time.Time {
-	cut := time.Now().Add(-window)
+// trackedIPsLocked returns the distinct IPs with a request window; one IP may
+// have several under RateLimitKey. The caller must hold l.mu.
+func (l *Limiter) trackedIPsLocked() map[string]bool {
+	ips := make(map[string]bool, len(l.reqByKey))
+	for _, win := range l.reqByKey {
+		ips[win.ip] = true
+	}
+	return ips
+}
+
+// FlaggedIPs returns the IPs that have been flagged, sorted.
+func (l *Limiter) FlaggedIPs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]string, 0, len(l.flaggedIPs))
+	for ip := range l.flaggedIPs {
+		out = append(out, ip)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ThrottledIPs returns the IPs with throttle strikes inside ThrottleWindow,
+// sorted. Expired strikes are pruned along the way.
+func (l *Limiter) ThrottledIPs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	out := make([]string, 0, len(l.throttleByIP))
+	for ip, ts := range l.throttleByIP {
+		ts = prune(ts, l.cfg.ThrottleWindow, now)
+		if len(ts) == 0 {
+			delete(l.throttleByIP, ip)
+			continue
+		}
+		l.throttleByIP[ip] = ts
+		out = append(out, ip)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func prune(ts []time.Time, window time.Duration, now time.Time) []time.Time {
+	cut := now.Add(-window)
 	idx := 0
 	for idx < len(ts) && ts[idx].Before(cut) {
 		idx++
@@ -328,6 +1344,15 @@ func prune(ts []time.Time, window time.Duration) []time.Time {
 	return ts[idx:]
 }
 
+func pruneHits(hs []hit, window time.Duration, now time.Time) []hit {
+	cut := now.Add(-window)
+	idx := 0
+	for idx < len(hs) && hs[idx].at.Before(cut) {
+		idx++
+	}
+	return hs[idx:]
+}
+
 func ClientIP(remoteAddr, xff string) string {
 	if xff != "" {
 		parts := strings.Split(xff, ",")
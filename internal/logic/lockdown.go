@@ -0,0 +1,81 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"tower/internal/db"
+)
+
+// LockdownSetting is the settings key holding "on" while lockdown is active.
+const LockdownSetting = "lockdown"
+
+// lockdownRefresh is how often the lockdown setting is re-read from the
+// database, so that toggles made by the CLI reach a running server.
+const lockdownRefresh = 5 * time.Second
+
+// lockdown is the global kill switch shared by a limiter and its tenants.
+// While it is on, every IP outside the allowlist is denied.
+type lockdown struct {
+	db *db.DB
+
+	mu        sync.Mutex
+	on        bool
+	checkedAt time.Time
+	allow     ipSet
+}
+
+func newLockdown(d *db.DB, allowlist []string) *lockdown {
+	return &lockdown{db: d, allow: newIPSet(allowlist)}
+}
+
+// active reports whether lockdown is on, refreshing the persisted setting
+// at most every lockdownRefresh.
+func (ld *lockdown) active(now time.Time) bool {
+	ld.mu.Lock()
+	defer ld.mu.Unlock()
+	if now.Sub(ld.checkedAt) >= lockdownRefresh || now.Before(ld.checkedAt) {
+		if v, ok, err := ld.db.GetSetting(LockdownSetting); err == nil {
+			ld.on = ok && v == "on"
+			ld.checkedAt = now
+		}
+	}
+	return ld.on
+}
+
+func (ld *lockdown) set(on bool, now time.Time) error {
+	v := "off"
+	if on {
+		v = "on"
+	}
+	if err := ld.db.SetSetting(LockdownSetting, v); err != nil {
+		return err
+	}
+	ld.mu.Lock()
+	ld.on = on
+	ld.checkedAt = now
+	ld.mu.Unlock()
+	return nil
+}
+
+// lockdownDecision returns the deny decision for ip when lockdown is active
+// and ip is not allowlisted.
+func (l *Limiter) lockdownDecision(ip string) (Decision, bool) {
+	if !l.lockdown.active(l.clock.Now()) || l.lockdown.allow.contains(ip) {
+		return Decision{}, false
+	}
+	return Decision{Action: ActionBan, IP: ip, Reason: "lockdown"}, true
+}
+
+// Lockdown reports whether lockdown mode is active.
+func (l *Limiter) Lockdown() bool {
+	return l.lockdown.active(l.clock.Now())
+}
+
+// SetLockdown turns lockdown mode on or off for every tenant. The state is
+// persisted and survives restarts. While on, requests from IPs outside
+// LockdownAllowlist are denied with a BAN decision that is neither recorded
+// as a ban nor sent to callbacks.
+func (l *Limiter) SetLockdown(on bool) error {
+	return l.lockdown.set(on, l.clock.Now())
+}
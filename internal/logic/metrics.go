@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMetricsBuckets are the histogram bucket upper bounds, in seconds,
+// used when MetricsBuckets is empty.
+var DefaultMetricsBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics holds the latency histograms exposed on /metrics.
+type metrics struct {
+	evaluate *histogram // Limiter.Evaluate
+	callback *histogram // one callback delivery
+}
+
+func newMetrics(buckets []float64) *metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultMetricsBuckets
+	}
+	return &metrics{evaluate: newHistogram(buckets), callback: newHistogram(buckets)}
+}
+
+// histogram is a Prometheus-style histogram of durations in seconds.
+type histogram struct {
+	mu      sync.Mutex
+	buckets []float64 // upper bounds, ascending
+	counts  []uint64  // per bucket, not cumulative
+	sum     float64
+	count   uint64
+}
+
+// newHistogram returns a histogram with the positive, distinct bounds of
+// buckets in ascending order.
+func newHistogram(buckets []float64) *histogram {
+	bounds := make([]float64, 0, len(buckets))
+	for _, b := range buckets {
+		if b > 0 {
+			bounds = append(bounds, b)
+		}
+	}
+	sort.Float64s(bounds)
+	uniq := bounds[:0]
+	for i, b := range bounds {
+		if i == 0 || b != bounds[i-1] {
+			uniq = append(uniq, b)
+		}
+	}
+	return &histogram{buckets: uniq, counts: make([]uint64, len(uniq))}
+}
+
+// observeSince records the time elapsed since start, so it can be deferred
+// as h.observeSince(time.Now()).
+func (h *histogram) observeSince(start time.Time) {
+	v := time.Since(start).Seconds()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+	h.count++
+}
+
+// write renders h in the Prometheus text exposition format.
+func (h *histogram) write(w io.Writer, name, help string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cum uint64
+	for i, b := range h.buckets {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+}
+
+// WriteMetrics writes the latency histograms and the pending ban write
+// gauge, shared by every tenant, in the Prometheus text exposition format.
+func (l *Limiter) WriteMetrics(w io.Writer) {
+	l.metrics.evaluate.write(w, "tower_evaluate_duration_seconds", "Time to evaluate a logged request.")
+	l.metrics.callback.write(w, "tower_callback_duration_seconds", "Time to deliver one callback, successful or not.")
+	fmt.Fprintf(w, "# HELP tower_pending_ban_writes Automatic bans enforced from memory while their database write is retried.\n"+
+		"# TYPE tower_pending_ban_writes gauge\ntower_pending_ban_writes %d\n", l.PendingBanWrites())
+}
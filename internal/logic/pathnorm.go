@@ -0,0 +1,39 @@
+package logic
+
+import (
+	"path"
+	"strings"
+)
+
+// normalizeRequestPath applies NormalizePaths and LowercasePaths to r,
+// keeping the path as received in RawPath when it changes.
+func (l *Limiter) normalizeRequestPath(r RequestLog) RequestLog {
+	if !l.cfg.NormalizePaths || r.Path == "" {
+		return r
+	}
+	if p := normalizePath(r.Path, l.cfg.LowercasePaths); p != r.Path {
+		r.RawPath, r.Path = r.Path, p
+	}
+	return r
+}
+
+// normalizePath undoes common probe obfuscation so equivalent paths compare
+// equal: duplicate slashes, "." and ".." segments and trailing dots on
+// segments ("/wp-admin." is "/wp-admin"). The query string is kept as is.
+func normalizePath(p string, lower bool) string {
+	p, query, hasQuery := strings.Cut(p, "?")
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		if s != "." && s != ".." {
+			segs[i] = strings.TrimRight(s, ".")
+		}
+	}
+	p = path.Clean("/" + strings.Join(segs, "/"))
+	if lower {
+		p = strings.ToLower(p)
+	}
+	if hasQuery {
+		p += "?" + query
+	}
+	return p
+}
@@ -0,0 +1,66 @@
+package logic
+
+import (
+	"time"
+
+	"tower/internal/config"
+)
+
+// CodePathScan is the Decision code of flags and bans for exceeding
+// DistinctPathThreshold.
+const CodePathScan = "PATH_SCAN"
+
+// pathScanLocked records r.Path as seen by r.IP and reports whether the IP
+// has touched more than DistinctPathThreshold distinct paths within
+// DistinctPathWindow. Paths last seen before the window are pruned first.
+// The caller must hold l.mu.
+func (l *Limiter) pathScanLocked(r RequestLog) bool {
+	if l.cfg.DistinctPathThreshold <= 0 || l.cfg.DistinctPathWindow <= 0 {
+		return false
+	}
+	paths := l.pathsByIP[r.IP]
+	if paths == nil {
+		paths = make(map[string]time.Time)
+		l.pathsByIP[r.IP] = paths
+	}
+	prunePaths(paths, l.cfg.DistinctPathWindow, l.clock.Now())
+	paths[r.Path] = r.Time
+	return len(paths) > l.cfg.DistinctPathThreshold
+}
+
+// pathScanDecisionLocked escalates a path scan by r.IP: the first is
+// flagged, later ones are banned, within the limits of Escalation and
+// StartupGracePeriod. The caller must hold l.mu.
+func (l *Limiter) pathScanDecisionLocked(r RequestLog) Decision {
+	_, flagged := l.flaggedIPs[r.IP]
+	switch {
+	case l.warmingUp(), l.cfg.Escalation == config.EscalationFlagOnly,
+		!flagged && l.cfg.Escalation != config.EscalationBanOnly:
+		d := l.flagLocked(r, "path scan detected")
+		d.Code = CodePathScan
+		return d
+	}
+	return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: path scan", Code: CodePathScan}
+}
+
+// prunePathsLocked drops the paths of every IP last seen before
+// DistinctPathWindow, so IPs that stop scanning are not tracked forever.
+// The caller must hold l.mu.
+func (l *Limiter) prunePathsLocked() {
+	now := l.clock.Now()
+	for ip, paths := range l.pathsByIP {
+		if prunePaths(paths, l.cfg.DistinctPathWindow, now); len(paths) == 0 {
+			delete(l.pathsByIP, ip)
+		}
+	}
+}
+
+// prunePaths deletes the paths in paths last seen more than window before now.
+func prunePaths(paths map[string]time.Time, window time.Duration, now time.Time) {
+	cut := now.Add(-window)
+	for p, at := range paths {
+		if at.Before(cut) {
+			delete(paths, p)
+		}
+	}
+}
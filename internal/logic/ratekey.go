@@ -0,0 +1,19 @@
+package logic
+
+import "strings"
+
+// rateKey expands the RateLimitKey template for r into the key its request
+// window is tracked under. An empty template means "{ip}", and "{user}" falls
+// back to the IP for requests logged without a user so anonymous traffic is
+// not pooled into a single window.
+func (l *Limiter) rateKey(r RequestLog) string {
+	tmpl := l.cfg.RateLimitKey
+	if tmpl == "" || tmpl == "{ip}" {
+		return r.IP
+	}
+	user := r.User
+	if user == "" {
+		user = r.IP
+	}
+	return strings.NewReplacer("{ip}", r.IP, "{user}", user, "{path}", r.Path).Replace(tmpl)
+}
@@ -0,0 +1,70 @@
+package logic
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"tower/internal/config"
+)
+
+// IPResolver extracts the client IP of an HTTP request, honoring
+// RealIPHeader and, once TrustedProxies is set, X-Forwarded-For only when the
+// connection comes from one of TrustedProxies.
+type IPResolver struct {
+	header  string
+	trusted ipSet
+}
+
+// NewIPResolver returns a resolver for cfg.RealIPHeader and cfg.TrustedProxies.
+func NewIPResolver(cfg config.Config) *IPResolver {
+	return &IPResolver{header: cfg.RealIPHeader, trusted: newIPSet(cfg.TrustedProxies)}
+}
+
+// ClientIP returns the value of the real-IP header when r arrives from a
+// trusted proxy, and otherwise falls back to ClientIP on X-Forwarded-For and
+// RemoteAddr. When TrustedProxies is set, both headers are ignored on
+// connections from any other peer and its RemoteAddr is used, so they cannot
+// be used to spoof another address. Without TrustedProxies, X-Forwarded-For
+// is honored from every peer as before.
+func (p *IPResolver) ClientIP(r *http.Request) string {
+	if !p.trusted.empty() && !p.fromTrustedProxy(r) {
+		return ClientIP(r.RemoteAddr, "")
+	}
+	if p.header != "" {
+		if v := strings.TrimSpace(r.Header.Get(p.header)); v != "" && p.fromTrustedProxy(r) {
+			ip, _, _ := strings.Cut(v, ",")
+			return strings.TrimSpace(ip)
+		}
+	}
+	return ClientIP(r.RemoteAddr, r.Header.Get("X-Forwarded-For"))
+}
+
+// ConnIP returns the IP r's connection came from, or ClientIP when that is
+// one of TrustedProxies. Unlike ClientIP it never honors headers from other
+// peers, even without TrustedProxies, so it suits per-connection limits
+// applied before authentication.
+func (p *IPResolver) ConnIP(r *http.Request) string {
+	if p.fromTrustedProxy(r) {
+		return p.ClientIP(r)
+	}
+	return ClientIP(r.RemoteAddr, "")
+}
+
+// Secure reports whether r reached tower over HTTPS: either directly over
+// TLS, or through one of TrustedProxies that set X-Forwarded-Proto: https.
+func (p *IPResolver) Secure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https") && p.fromTrustedProxy(r)
+}
+
+func (p *IPResolver) fromTrustedProxy(r *http.Request) bool {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	return p.trusted.contains(peer)
+}
@@ -0,0 +1,82 @@
+package logic
+
+import (
+	"reflect"
+	"sort"
+
+	"tower/internal/config"
+)
+
+// reloadable lists the Config fields Reload applies to a running limiter:
+// limits, windows and escalation modes. They are only read with l.mu held,
+// so they can be swapped under it without racing in-flight requests.
+var reloadable = map[string]bool{
+	"RequestWindow":         true,
+	"RequestLimit":          true,
+	"BurstGrace":            true,
+	"ThrottleWindow":        true,
+	"ThrottleLimit":         true,
+	"BanDuration":           true,
+	"Escalation":            true,
+	"ReasonDurations":       true,
+	"GoodBehaviorWindow":    true,
+	"ErrorStatusLimit":      true,
+	"ErrorStatusWindow":     true,
+	"DistinctPathThreshold": true,
+	"DistinctPathWindow":    true,
+	"BannedMethods":         true,
+	"UncountedMethods":      true,
+	"RateLimitKey":          true,
+	"RetryAfterJitter":      true,
+}
+
+// Config returns a copy of the limiter's current configuration.
+func (l *Limiter) Config() config.Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cfg
+}
+
+// Reload applies the limits, windows and modes of cfg to l and its tenant
+// limiters without dropping their state, and returns the names of the
+// fields that changed. When cfg also changes fields that need a restart,
+// such as Addr or DataDir, nothing is applied and those fields are returned
+// as restart instead. Both lists are sorted.
+func (l *Limiter) Reload(cfg config.Config) (applied, restart []string) {
+	cur := reflect.ValueOf(l.Config())
+	next := reflect.ValueOf(cfg)
+	t := cur.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if reflect.DeepEqual(cur.Field(i).Interface(), next.Field(i).Interface()) {
+			continue
+		}
+		if name := t.Field(i).Name; reloadable[name] {
+			applied = append(applied, name)
+		} else {
+			restart = append(restart, name)
+		}
+	}
+	sort.Strings(applied)
+	sort.Strings(restart)
+	if len(restart) > 0 || len(applied) == 0 {
+		return nil, restart
+	}
+
+	// Holding tenantMu keeps a tenant from being created from the root's
+	// config halfway through.
+	l.tenantMu.Lock()
+	defer l.tenantMu.Unlock()
+	targets := []*Limiter{l}
+	for _, tl := range l.tenants {
+		targets = append(targets, tl)
+	}
+	for _, tl := range targets {
+		tl.mu.Lock()
+		dst := reflect.ValueOf(&tl.cfg).Elem()
+		for _, name := range applied {
+			dst.FieldByName(name).Set(next.FieldByName(name))
+		}
+		tl.mu.Unlock()
+	}
+	return applied, nil
+}
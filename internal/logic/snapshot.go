@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// limiterState is the persisted form of a limiter's escalation progress.
+type limiterState struct {
+	Flagged   map[string]time.Time   `json:"flagged,omitempty"`
+	Throttles map[string][]time.Time `json:"throttles,omitempty"`
+	Violation map[string]time.Time   `json:"violation,omitempty"`
+}
+
+// Snapshot saves the flagged and throttle state of this limiter and every
+// tenant limiter to the database, so a restart does not reset the escalation
+// progress of recent offenders. Request counters are not saved.
+func (l *Limiter) Snapshot() error {
+	for _, t := range l.tenantLimiters() {
+		if err := t.snapshot(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Limiter) snapshot() error {
+	l.mu.Lock()
+	now := l.clock.Now()
+	st := limiterState{
+		Flagged:   make(map[string]time.Time, len(l.flaggedIPs)),
+		Throttles: make(map[string][]time.Time, len(l.throttleByIP)),
+		Violation: make(map[string]time.Time, len(l.lastViolation)),
+	}
+	for ip, at := range l.flaggedIPs {
+		st.Flagged[ip] = at
+	}
+	for ip, ts := range l.throttleByIP {
+		if ts = prune(ts, l.cfg.ThrottleWindow, now); len(ts) > 0 {
+			st.Throttles[ip] = ts
+		}
+	}
+	for ip, at := range l.lastViolation {
+		st.Violation[ip] = at
+	}
+	l.mu.Unlock()
+
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return l.db.SaveLimiterState(b)
+}
+
+// Restore loads the state saved by Snapshot for this limiter's tenant,
+// merging it into the current in-memory state. Tenant limiters restore their
+// own state when first created.
+func (l *Limiter) Restore() error {
+	b, ok, err := l.db.LoadLimiterState()
+	if err != nil || !ok {
+		return err
+	}
+	var st limiterState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.clock.Now()
+	for ip, at := range st.Flagged {
+		if _, ok := l.flaggedIPs[ip]; !ok {
+			l.flaggedIPs[ip] = at
+		}
+	}
+	for ip, ts := range st.Throttles {
+		merged := append(ts, l.throttleByIP[ip]...)
+		sort.Slice(merged, func(i, j int) bool { return merged[i].Before(merged[j]) })
+		merged = prune(merged, l.cfg.ThrottleWindow, now)
+		if len(merged) > 0 {
+			l.throttleByIP[ip] = merged
+		}
+	}
+	// Violations only matter, and are only tracked, with GoodBehaviorWindow.
+	if l.cfg.GoodBehaviorWindow > 0 {
+		for ip, at := range st.Violation {
+			if cur, ok := l.lastViolation[ip]; !ok || at.After(cur) {
+				l.lastViolation[ip] = at
+			}
+		}
+	}
+	return nil
+}
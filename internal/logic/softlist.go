@@ -0,0 +1,82 @@
+package logic
+
+import (
+	"sync"
+	"time"
+
+	"tower/internal/db"
+)
+
+// softListRefresh is how often a limiter re-reads its soft list from the
+// database, so entries added by the CLI reach a running server.
+const softListRefresh = 5 * time.Second
+
+// softList holds a tenant's soft-listed IPs and CIDRs: addresses such as
+// shared NAT gateways that may be throttled but are never banned.
+type softList struct {
+	db *db.DB
+
+	mu        sync.Mutex
+	set       ipSet
+	checkedAt time.Time
+}
+
+func newSoftList(d *db.DB) *softList {
+	return &softList{db: d, set: newIPSet(nil)}
+}
+
+// contains reports whether ip is soft-listed, refreshing from the database at
+// most every softListRefresh.
+func (s *softList) contains(ip string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.checkedAt) >= softListRefresh || now.Before(s.checkedAt) {
+		s.reloadLocked(now)
+	}
+	return s.set.contains(ip)
+}
+
+func (s *softList) reloadLocked(now time.Time) {
+	entries, err := s.db.ListSoftListed()
+	if err != nil {
+		return
+	}
+	s.set = newIPSet(entries)
+	s.checkedAt = now
+}
+
+// SoftListIP adds ip (an address or CIDR) to this tenant's soft list. Would-be
+// bans for soft-listed addresses are downgraded to THROTTLE.
+func (l *Limiter) SoftListIP(ip string) error {
+	if err := l.db.SoftListIP(ip); err != nil {
+		return err
+	}
+	l.softList.mu.Lock()
+	l.softList.reloadLocked(l.clock.Now())
+	l.softList.mu.Unlock()
+	return nil
+}
+
+// UnsoftListIP removes ip from this tenant's soft list.
+func (l *Limiter) UnsoftListIP(ip string) error {
+	if err := l.db.UnsoftListIP(ip); err != nil {
+		return err
+	}
+	l.softList.mu.Lock()
+	l.softList.reloadLocked(l.clock.Now())
+	l.softList.mu.Unlock()
+	return nil
+}
+
+// soften downgrades a BAN decision for a soft-listed IP to THROTTLE.
+func (l *Limiter) soften(d Decision) Decision {
+	if d.Action != ActionBan || !l.softList.contains(d.IP, l.clock.Now()) {
+		return d
+	}
+	return Decision{
+		Action:     ActionThrottle,
+		IP:         d.IP,
+		Reason:     "rate limit exceeded (soft-listed)",
+		RetryAfter: l.retryAfter(),
+	}
+}
@@ -0,0 +1,60 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"tower/internal/db"
+)
+
+// StartStatsSampler launches a background goroutine that records every
+// tenant's Stats each StatsSampleInterval. It stops when ctx is cancelled.
+func (l *Limiter) StartStatsSampler(ctx context.Context) {
+	interval := l.cfg.StatsSampleInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = l.SampleStats()
+			}
+		}
+	}()
+}
+
+// SampleStats records one stats sample for this limiter and each of its
+// tenants, then drops samples older than StatsRetention.
+func (l *Limiter) SampleStats() error {
+	now := l.clock.Now()
+	for _, t := range l.tenantLimiters() {
+		bans, flagged, tracked, recent := t.Stats()
+		err := t.db.RecordStatsSample(db.StatsSample{
+			At:             now,
+			ActiveBans:     bans,
+			FlaggedIPs:     flagged,
+			TrackedIPs:     tracked,
+			RecentRequests: recent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if l.cfg.StatsRetention > 0 {
+		if _, err := l.db.DeleteStatsSamplesBefore(now.Add(-l.cfg.StatsRetention)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StatsSamples returns this tenant's stats samples taken since since, oldest
+// first.
+func (l *Limiter) StatsSamples(since time.Time) ([]db.StatsSample, error) {
+	return l.db.ListStatsSamples(since)
+}
@@ -0,0 +1,91 @@
+package logic
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"tower/internal/config"
+)
+
+// CodeUABlocked is the Decision code of flags and bans for a
+// BannedUserAgents match.
+const CodeUABlocked = "UA_BLOCKED"
+
+// CompileUserAgentPatterns compiles BannedUserAgents/AllowedUserAgents
+// entries. An entry between slashes, such as "/sqlmap|nikto/", is a regular
+// expression matched anywhere in the User-Agent; any other entry is a glob
+// ("*" and "?") matched against the whole User-Agent. Both ignore case.
+func CompileUserAgentPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	out := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		expr := globToRegexp(p)
+		if len(p) > 2 && strings.HasPrefix(p, "/") && strings.HasSuffix(p, "/") {
+			expr = p[1 : len(p)-1]
+		}
+		re, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, fmt.Errorf("user agent pattern %q: %w", p, err)
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+// globToRegexp turns a glob into an anchored regular expression.
+func globToRegexp(glob string) string {
+	expr := regexp.QuoteMeta(glob)
+	expr = strings.ReplaceAll(expr, `\*`, ".*")
+	expr = strings.ReplaceAll(expr, `\?`, ".")
+	return "^" + expr + "$"
+}
+
+// compileValidUserAgents compiles patterns for the limiter, logging and
+// skipping invalid entries; serve validates them up front.
+func compileValidUserAgents(patterns []string) []*regexp.Regexp {
+	var out []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := CompileUserAgentPatterns([]string{p})
+		if err != nil {
+			log.Printf("ignoring %v", err)
+			continue
+		}
+		out = append(out, re...)
+	}
+	return out
+}
+
+// userAgentBlocked reports whether ua matches BannedUserAgents and not
+// AllowedUserAgents.
+func (l *Limiter) userAgentBlocked(ua string) bool {
+	if ua == "" || !matchAny(l.uaBanned, ua) {
+		return false
+	}
+	return !matchAny(l.uaAllowed, ua)
+}
+
+// userAgentDecisionLocked answers a request from a blocked user agent: it is
+// banned outright, or only flagged under flag-only Escalation and during
+// StartupGracePeriod. The caller must hold l.mu.
+func (l *Limiter) userAgentDecisionLocked(r RequestLog) Decision {
+	if l.warmingUp() || l.cfg.Escalation == config.EscalationFlagOnly {
+		d := l.flagLocked(r, "blocked user agent")
+		d.Code = CodeUABlocked
+		return d
+	}
+	return Decision{Action: ActionBan, IP: r.IP, Reason: "auto-ban: blocked user agent", Code: CodeUABlocked}
+}
+
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
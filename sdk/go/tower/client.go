@@ -4,33 +4,78 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"sync"
 	"time"
+
+	"tower/api"
 )
 
 type Client struct {
 	BaseURL string
 	Key     string
+	Tenant  string // optional; sent as X-Tower-Tenant when set
 	HTTP    *http.Client
+
+	headers http.Header   // extra headers sent with every request
+	timeout time.Duration // set by WithTimeout; applied once New has run every option
+
+	configMu sync.Mutex
+	config   *ServerConfig // cached by GetConfig
+}
+
+// ClientOption configures a Client created with New.
+type ClientOption func(*Client)
+
+// WithHTTPClient makes the client send requests through hc, e.g. one with a
+// custom transport for mTLS or proxies. A nil hc uses the default client.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) { c.HTTP = hc }
+}
+
+// WithTimeout sets the overall timeout of each request. The default is 10s.
+// It applies to the client given to WithHTTPClient too, whatever the order
+// of the options; that client itself is not modified.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(c *Client) { c.timeout = d }
 }
 
-func New(baseURL, key string) *Client {
-	return &Client{
+// WithHeader adds a header, such as a tracing header, to every request.
+// Auth and tenant headers cannot be overridden this way.
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = http.Header{}
+		}
+		c.headers.Add(key, value)
+	}
+}
+
+func New(baseURL, key string, opts ...ClientOption) *Client {
+	c := &Client{
 		BaseURL: baseURL,
 		Key:     key,
 		HTTP:    &http.Client{Timeout: 10 * time.Second},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.HTTP == nil {
+		c.HTTP = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.timeout > 0 {
+		hc := *c.HTTP
+		hc.Timeout = c.timeout
+		c.HTTP = &hc
+	}
+	return c
 }
 
-// Decision represents Tower's escalation decision for an IP.
-type Decision struct {
-	Action     string `json:"action"`      // ALLOW, FLAG, THROTTLE, BAN
-	IP         string `json:"ip"`
-	Reason     string `json:"reason,omitempty"`
-	RetryAfter int    `json:"retry_after,omitempty"`
-}
+// Decision represents Tower's escalation decision for an IP. It is the same
+// type the server serializes.
+type Decision = api.Decision
 
 // Inspect checks an IP against Tower without recording a request.
 func (c *Client) Inspect(ctx context.Context, ip string) (Decision, error) {
@@ -39,6 +84,56 @@ func (c *Client) Inspect(ctx context.Context, ip string) (Decision, error) {
 	return d, err
 }
 
+// BanStatus is whether an IP is banned and how long the ban has left.
+type BanStatus = api.BanStatus
+
+// BanStatus reports whether ip is banned and the time remaining, for showing
+// "try again in X". SecondsRemaining is -1 for permanent bans.
+func (c *Client) BanStatus(ctx context.Context, ip string) (BanStatus, error) {
+	var s BanStatus
+	err := c.get(ctx, "/api/v1/ban-status?ip="+url.QueryEscape(ip), &s)
+	return s, err
+}
+
+// BanStatusBatch reports the ban status of each of ips in one call, keyed by
+// IP. At most api.MaxBanStatusBatch (1000) IPs may be sent at once.
+func (c *Client) BanStatusBatch(ctx context.Context, ips []string) (map[string]BanStatus, error) {
+	var out map[string]BanStatus
+	err := c.post(ctx, "/api/v1/ban-status/batch", map[string][]string{"ips": ips}, &out)
+	return out, err
+}
+
+// ServerConfig summarizes the server's limits and modes.
+type ServerConfig = api.ServerConfig
+
+// GetConfig returns the server's limits and modes so callers can throttle
+// themselves to match. It needs the admin token as key. The first successful
+// fetch is cached for the life of the client; RefreshConfig fetches again.
+func (c *Client) GetConfig(ctx context.Context) (ServerConfig, error) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	if c.config != nil {
+		return *c.config, nil
+	}
+	return c.fetchConfigLocked(ctx)
+}
+
+// RefreshConfig fetches the server config again, replacing the cached copy.
+func (c *Client) RefreshConfig(ctx context.Context) (ServerConfig, error) {
+	c.configMu.Lock()
+	defer c.configMu.Unlock()
+	return c.fetchConfigLocked(ctx)
+}
+
+func (c *Client) fetchConfigLocked(ctx context.Context) (ServerConfig, error) {
+	var cfg ServerConfig
+	if err := c.get(ctx, "/api/v1/admin/config", &cfg); err != nil {
+		return ServerConfig{}, err
+	}
+	c.config = &cfg
+	return cfg, nil
+}
+
 // LogRequest reports a request to Tower for rate limiting and returns the decision.
 func (c *Client) LogRequest(ctx context.Context, method, path, ip string) (Decision, error) {
 	var d Decision
@@ -51,14 +146,68 @@ func (c *Client) LogRequest(ctx context.Context, method, path, ip string) (Decis
 	return d, err
 }
 
+// LogWeightedRequest is like LogRequest but counts the request as weight
+// requests toward the rate limit, for endpoints that are more expensive.
+func (c *Client) LogWeightedRequest(ctx context.Context, method, path, ip string, weight int) (Decision, error) {
+	var d Decision
+	payload := map[string]interface{}{
+		"method": method,
+		"path":   path,
+		"ip":     ip,
+		"weight": weight,
+	}
+	err := c.post(ctx, "/api/v1/log", payload, &d)
+	return d, err
+}
+
+// LogEntry describes a request reported with Log.
+type LogEntry struct {
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	IP     string `json:"ip,omitempty"`
+	User   string `json:"user,omitempty"`   // application user, for the server's rate_limit_key
+	Weight int    `json:"weight,omitempty"` // cost toward the limit; 0 means 1
+	Status int    `json:"status,omitempty"` // response status, feeds 4xx-storm detection
+	Body   string `json:"body,omitempty"`   // request body; kept only if the server sets log_body_bytes
+
+	UserAgent string `json:"user_agent,omitempty"` // checked against the server's banned_user_agents
+	Source    string `json:"source,omitempty"`     // forwarding proxy ID; makes IP, not the caller, the ban subject
+}
+
+// Log reports a request with optional weight and response status and
+// returns the decision.
+func (c *Client) Log(ctx context.Context, e LogEntry) (Decision, error) {
+	var d Decision
+	err := c.post(ctx, "/api/v1/log", e, &d)
+	return d, err
+}
+
 // RegisterCallback registers a URL to receive security event notifications.
 func (c *Client) RegisterCallback(ctx context.Context, callbackURL string) error {
 	return c.post(ctx, "/api/v1/callbacks", map[string]string{"url": callbackURL}, nil)
 }
 
+// UnregisterCallback removes a previously registered callback URL.
+func (c *Client) UnregisterCallback(ctx context.Context, callbackURL string) error {
+	return c.send(ctx, http.MethodDelete, "/api/v1/callbacks", map[string]string{"url": callbackURL}, nil)
+}
+
+// Callbacks lists the registered callback URLs.
+func (c *Client) Callbacks(ctx context.Context) ([]string, error) {
+	var out struct {
+		Callbacks []string `json:"callbacks"`
+	}
+	err := c.get(ctx, "/api/v1/callbacks", &out)
+	return out.Callbacks, err
+}
+
 func (c *Client) post(ctx context.Context, p string, payload interface{}, out interface{}) error {
+	return c.send(ctx, http.MethodPost, p, payload, out)
+}
+
+func (c *Client) send(ctx context.Context, method, p string, payload interface{}, out interface{}) error {
 	b, _ := json.Marshal(payload)
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+p, bytes.NewReader(b))
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+p, bytes.NewReader(b))
 	if err != nil {
 		return err
 	}
@@ -86,14 +235,13 @@ func (c *Client) do(req *http.Request, out interface{}) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 300 {
-		var e struct {
-			Error string `json:"error"`
-		}
-		_ = json.NewDecoder(resp.Body).Decode(&e)
-		if e.Error != "" {
-			return fmt.Errorf("tower error: %s", e.Error)
+		body, _ := io.ReadAll(resp.Body)
+		// Blocking responses (403/429) still carry a decision; decode it so
+		// callers can inspect the action alongside the error.
+		if out != nil {
+			_ = json.Unmarshal(body, out)
 		}
-		return fmt.Errorf("tower error: %s", resp.Status)
+		return newError(resp, body)
 	}
 	if out != nil {
 		return json.NewDecoder(resp.Body).Decode(out)
@@ -102,8 +250,16 @@ func (c *Client) do(req *http.Request, out interface{}) error {
 }
 
 func (c *Client) applyAuth(req *http.Request) {
+	for k, vs := range c.headers {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Tower-Key", c.Key)
+	if c.Tenant != "" {
+		req.Header.Set("X-Tower-Tenant", c.Tenant)
+	}
 }
 
 func NormalizeBaseURL(u string) string {
@@ -0,0 +1,73 @@
+package tower
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"tower/api"
+)
+
+// Sentinel errors matched with errors.Is against errors returned by Client
+// methods.
+var (
+	ErrBanned       = errors.New("tower: ip banned")
+	ErrThrottled    = errors.New("tower: ip throttled")
+	ErrUnauthorized = errors.New("tower: unauthorized")
+)
+
+// Error is returned for any non-2xx response from Tower.
+type Error struct {
+	StatusCode int    // HTTP status
+	Code       string // error code or decision action, when the body has one
+	Message    string // error message, or the HTTP status text
+}
+
+func (e *Error) Error() string {
+	return "tower error: " + e.Message
+}
+
+// Unwrap maps the response onto ErrBanned, ErrThrottled or ErrUnauthorized,
+// or returns nil for other failures.
+func (e *Error) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden && (e.Code == string(api.ActionBan) || e.Message == "ip banned"):
+		return ErrBanned
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrThrottled
+	}
+	return nil
+}
+
+// newError builds an *Error from a failed response. Tower reports errors as
+// {"error":"message"}, {"error":{"code":..,"message":..}} or, for blocking
+// decisions, the decision itself.
+func newError(resp *http.Response, body []byte) *Error {
+	e := &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+	var raw struct {
+		Error  json.RawMessage `json:"error"`
+		Action string          `json:"action"`
+		Reason string          `json:"reason"`
+	}
+	if json.Unmarshal(body, &raw) != nil {
+		return e
+	}
+	var msg string
+	var obj struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	switch {
+	case json.Unmarshal(raw.Error, &msg) == nil && msg != "":
+		e.Message = msg
+	case json.Unmarshal(raw.Error, &obj) == nil && obj.Message != "":
+		e.Code, e.Message = obj.Code, obj.Message
+	case raw.Action != "":
+		e.Code = raw.Action
+		e.Message = fmt.Sprintf("%s: %s", raw.Action, raw.Reason)
+	}
+	return e
+}
@@ -0,0 +1,80 @@
+package tower
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"tower/api"
+)
+
+// DecisionEvent is one decision streamed by StreamDecisions.
+type DecisionEvent = api.DecisionEvent
+
+// StreamDecisions subscribes to the server's decision stream
+// (/api/v1/admin/events, which needs the admin token as key) and calls fn for
+// every event until ctx is canceled, the server closes the stream or fn
+// returns an error, which is returned. Only ctx bounds the stream; the client
+// timeout is not applied.
+func (c *Client) StreamDecisions(ctx context.Context, fn func(DecisionEvent) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.BaseURL+"/api/v1/admin/events", nil)
+	if err != nil {
+		return err
+	}
+	c.applyAuth(req)
+	req.Header.Set("Accept", "text/event-stream")
+
+	hc := http.Client{}
+	if c.HTTP != nil {
+		hc = *c.HTTP
+	}
+	hc.Timeout = 0
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return newError(resp, body)
+	}
+	if err := readEvents(resp.Body, fn); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// readEvents parses a Server-Sent Events stream, passing the data of each
+// "decision" event to fn. Comments and other event types are skipped.
+func readEvents(r io.Reader, fn func(DecisionEvent) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	event, data := "", ""
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if data != "" && (event == "" || event == "decision") {
+				var ev DecisionEvent
+				if err := json.Unmarshal([]byte(data), &ev); err != nil {
+					return err
+				}
+				if err := fn(ev); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != "" {
+				data += "\n"
+			}
+			data += strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,203 @@
+package tower
+
+import (
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tower/api"
+	"tower/internal/blockpage"
+)
+
+type middlewareConfig struct {
+	failClosed  bool
+	banTTL      time.Duration
+	blockedPage *template.Template
+	trusted     []*net.IPNet
+}
+
+// MiddlewareOption configures Middleware.
+type MiddlewareOption func(*middlewareConfig)
+
+// FailClosed makes the middleware reject requests with 503 when Tower cannot
+// be reached. By default the middleware fails open and lets requests through.
+func FailClosed() MiddlewareOption {
+	return func(m *middlewareConfig) { m.failClosed = true }
+}
+
+// CacheBans makes the middleware remember BAN decisions locally for ttl, so
+// requests from a banned IP are rejected without calling Tower. Other
+// decisions are always re-checked.
+func CacheBans(ttl time.Duration) MiddlewareOption {
+	return func(m *middlewareConfig) { m.banTTL = ttl }
+}
+
+// DefaultBlockedPage is the html/template source of the page browsers get for
+// blocked requests when no BlockedPage is set.
+const DefaultBlockedPage = blockpage.Default
+
+// BlockedPage sets the html/template rendered, with an api.BlockedPage, for
+// blocked requests whose Accept header prefers HTML. Without it browsers get
+// DefaultBlockedPage; clients preferring JSON always get the decision as
+// JSON.
+func BlockedPage(tmpl *template.Template) MiddlewareOption {
+	return func(m *middlewareConfig) { m.blockedPage = tmpl }
+}
+
+// TrustedProxies makes the middleware attribute requests to the first
+// X-Forwarded-For entry when RemoteAddr is one of proxies (IPs or CIDRs);
+// invalid entries are ignored. By default the header is ignored and requests
+// are attributed to RemoteAddr, since any client can set it.
+func TrustedProxies(proxies ...string) MiddlewareOption {
+	return func(m *middlewareConfig) {
+		for _, p := range proxies {
+			if _, n, err := net.ParseCIDR(p); err == nil {
+				m.trusted = append(m.trusted, n)
+			} else if ip := net.ParseIP(p); ip != nil {
+				bits := 8 * len(ip)
+				if v4 := ip.To4(); v4 != nil {
+					ip, bits = v4, 32
+				}
+				m.trusted = append(m.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		}
+	}
+}
+
+// banCache is a small TTL cache of BAN decisions keyed by IP.
+type banCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]banEntry
+}
+
+type banEntry struct {
+	decision Decision
+	expires  time.Time
+}
+
+func (b *banCache) get(ip string) (Decision, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[ip]
+	if !ok {
+		return Decision{}, false
+	}
+	if time.Now().After(e.expires) {
+		delete(b.entries, ip)
+		return Decision{}, false
+	}
+	return e.decision, true
+}
+
+func (b *banCache) put(ip string, d Decision) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[ip] = banEntry{decision: d, expires: time.Now().Add(b.ttl)}
+}
+
+func (b *banCache) forget(ip string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, ip)
+}
+
+// Middleware returns net/http middleware that reports every request to Tower
+// and blocks it when the decision is BAN (403) or THROTTLE (429).
+func Middleware(c *Client, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := middlewareConfig{}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	var cache *banCache
+	if cfg.banTTL > 0 {
+		cache = &banCache{ttl: cfg.banTTL, entries: make(map[string]banEntry)}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := cfg.clientIP(r)
+			if cache != nil {
+				if d, ok := cache.get(ip); ok {
+					writeBlocked(w, r, http.StatusForbidden, d, cfg.blockedPage)
+					return
+				}
+			}
+			d, err := c.LogRequest(r.Context(), r.Method, r.URL.Path, ip)
+			if cache != nil {
+				if d.Action == api.ActionBan {
+					cache.put(ip, d)
+				} else if err != nil {
+					cache.forget(ip)
+				}
+			}
+			switch d.Action {
+			case api.ActionBan:
+				writeBlocked(w, r, http.StatusForbidden, d, cfg.blockedPage)
+				return
+			case api.ActionThrottle:
+				if d.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(d.RetryAfter))
+				}
+				writeBlocked(w, r, http.StatusTooManyRequests, d, cfg.blockedPage)
+				return
+			}
+			if err != nil && d.Action == "" && cfg.failClosed {
+				writeBlocked(w, r, http.StatusServiceUnavailable, Decision{Reason: "tower unavailable"}, cfg.blockedPage)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the first X-Forwarded-For entry when r comes from a
+// trusted proxy, and ClientIP otherwise.
+func (m middlewareConfig) clientIP(r *http.Request) string {
+	ip := ClientIP(r)
+	if !m.trusts(ip) {
+		return ip
+	}
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		return strings.TrimSpace(strings.Split(xff, ",")[0])
+	}
+	return ip
+}
+
+func (m middlewareConfig) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range m.trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP of the connection r came in on. It ignores
+// X-Forwarded-For, which the client controls; see TrustedProxies.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err == nil && host != "" {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// writeBlocked answers a blocked request with an HTML page or plain text when
+// its Accept header prefers them, and with d as JSON otherwise.
+func writeBlocked(w http.ResponseWriter, r *http.Request, status int, d Decision, tmpl *template.Template) {
+	if blockpage.Write(w, r, status, d, tmpl) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(d)
+}
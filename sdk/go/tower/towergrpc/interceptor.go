@@ -0,0 +1,140 @@
+// Package towergrpc provides gRPC server interceptors that report each call
+// to Tower and reject it on THROTTLE or BAN. It is a separate module so the
+// main SDK does not depend on gRPC.
+package towergrpc
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"tower/api"
+	tower "tower/sdk/go/tower"
+)
+
+type config struct {
+	failClosed bool
+	trusted    []*net.IPNet
+}
+
+// Option configures the interceptors.
+type Option func(*config)
+
+// FailClosed makes the interceptors reject calls with codes.Unavailable when
+// Tower cannot be reached. By default they fail open and let calls through.
+func FailClosed() Option {
+	return func(c *config) { c.failClosed = true }
+}
+
+// TrustedProxies makes the interceptors attribute calls to the first
+// x-forwarded-for metadata entry when the peer address is one of proxies
+// (IPs or CIDRs); invalid entries are ignored. By default the metadata is
+// ignored and calls are attributed to the peer, since any client can set it.
+func TrustedProxies(proxies ...string) Option {
+	return func(c *config) {
+		for _, p := range proxies {
+			if _, n, err := net.ParseCIDR(p); err == nil {
+				c.trusted = append(c.trusted, n)
+			} else if ip := net.ParseIP(p); ip != nil {
+				bits := 8 * len(ip)
+				if v4 := ip.To4(); v4 != nil {
+					ip, bits = v4, 32
+				}
+				c.trusted = append(c.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			}
+		}
+	}
+}
+
+// UnaryServerInterceptor reports every unary call to Tower as a POST of its
+// full method name and rejects it with codes.PermissionDenied on BAN and
+// codes.ResourceExhausted on THROTTLE.
+func UnaryServerInterceptor(c *tower.Client, opts ...Option) grpc.UnaryServerInterceptor {
+	check := checker(c, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := check(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming calls. The
+// check runs once, when the stream opens.
+func StreamServerInterceptor(c *tower.Client, opts ...Option) grpc.StreamServerInterceptor {
+	check := checker(c, opts)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := check(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checker(c *tower.Client, opts []Option) func(ctx context.Context, method string) error {
+	cfg := config{}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	return func(ctx context.Context, method string) error {
+		d, err := c.LogRequest(ctx, "POST", method, cfg.clientIP(ctx))
+		switch d.Action {
+		case api.ActionBan:
+			return status.Error(codes.PermissionDenied, "tower: "+d.Reason)
+		case api.ActionThrottle:
+			return status.Error(codes.ResourceExhausted, "tower: "+d.Reason)
+		}
+		if err != nil && d.Action == "" && cfg.failClosed {
+			return status.Error(codes.Unavailable, "tower unavailable")
+		}
+		return nil
+	}
+}
+
+// clientIP returns the first x-forwarded-for metadata entry when the call
+// comes from a trusted proxy, and PeerIP otherwise.
+func (c config) clientIP(ctx context.Context) string {
+	ip := PeerIP(ctx)
+	if !c.trusts(ip) {
+		return ip
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if xff := md.Get("x-forwarded-for"); len(xff) > 0 && xff[0] != "" {
+			return strings.TrimSpace(strings.Split(xff[0], ",")[0])
+		}
+	}
+	return ip
+}
+
+func (c config) trusts(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, n := range c.trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerIP returns the IP of the peer a gRPC call came from. It ignores
+// x-forwarded-for metadata, which the caller controls; see TrustedProxies.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,140 @@
+package towergrpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"tower/api"
+	tower "tower/sdk/go/tower"
+	"tower/sdk/go/tower/towergrpc"
+)
+
+// stubTower answers /api/v1/log with a fixed decision per IP, allowing
+// unknown IPs, and records the logged IPs and methods.
+func stubTower(t *testing.T, logged chan<- string) *httptest.Server {
+	decisions := map[string]struct {
+		status int
+		action api.Action
+	}{
+		"10.0.67.1": {http.StatusOK, api.ActionAllow},
+		"10.0.67.2": {http.StatusTooManyRequests, api.ActionThrottle},
+		"10.0.67.3": {http.StatusForbidden, api.ActionBan},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p struct{ IP, Method, Path string }
+		_ = json.NewDecoder(r.Body).Decode(&p)
+		logged <- p.IP + " " + p.Method + " " + p.Path
+		d, ok := decisions[p.IP]
+		if !ok {
+			d.status, d.action = http.StatusOK, api.ActionAllow
+		}
+		w.WriteHeader(d.status)
+		_ = json.NewEncoder(w).Encode(api.Decision{Action: d.action, IP: p.IP, Reason: "stub"})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// serve starts a health server with the interceptors on a loopback TCP
+// listener and returns a client connected to it.
+func serve(t *testing.T, c *tower.Client, opts ...towergrpc.Option) healthpb.HealthClient {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("[GRPC] listen: %v", err)
+	}
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(towergrpc.UnaryServerInterceptor(c, opts...)),
+		grpc.StreamInterceptor(towergrpc.StreamServerInterceptor(c, opts...)),
+	)
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("[GRPC] dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+func TestInterceptors(t *testing.T) {
+	logged := make(chan string, 16)
+	client := serve(t, tower.New(stubTower(t, logged).URL, "key"), towergrpc.TrustedProxies("127.0.0.0/8"))
+
+	for _, tc := range []struct {
+		ip   string
+		want codes.Code
+	}{
+		{"10.0.67.1", codes.OK},
+		{"10.0.67.2", codes.ResourceExhausted},
+		{"10.0.67.3", codes.PermissionDenied},
+	} {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", tc.ip)
+
+		_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+		t.Logf("[GRPC] unary %s → %v", tc.ip, status.Code(err))
+		if status.Code(err) != tc.want {
+			t.Fatalf("[GRPC] unary %s: expected %s, got %v", tc.ip, tc.want, err)
+		}
+		if got := <-logged; got != tc.ip+" POST "+healthpb.Health_Check_FullMethodName {
+			t.Fatalf("[GRPC] logged %q", got)
+		}
+
+		stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+		}
+		t.Logf("[GRPC] stream %s → %v", tc.ip, status.Code(err))
+		if status.Code(err) != tc.want {
+			t.Fatalf("[GRPC] stream %s: expected %s, got %v", tc.ip, tc.want, err)
+		}
+		<-logged
+	}
+}
+
+func TestSpoofedForwardedForIgnored(t *testing.T) {
+	logged := make(chan string, 4)
+	client := serve(t, tower.New(stubTower(t, logged).URL, "key"))
+
+	// 10.0.67.3 is banned, but an untrusted caller cannot claim its address.
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-forwarded-for", "10.0.67.3")
+	_, err := client.Check(ctx, &healthpb.HealthCheckRequest{})
+	got := <-logged
+	t.Logf("[GRPC] spoofed x-forwarded-for → logged %q, %v", got, status.Code(err))
+	if err != nil {
+		t.Fatalf("[GRPC] expected the peer to be allowed, got %v", err)
+	}
+	if got != "127.0.0.1 POST "+healthpb.Health_Check_FullMethodName {
+		t.Fatalf("[GRPC] expected the peer IP to be logged, got %q", got)
+	}
+}
+
+func TestFailClosed(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	c := tower.New(down.URL, "key")
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/svc/Call"}
+	ok := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+
+	if _, err := towergrpc.UnaryServerInterceptor(c)(context.Background(), nil, info, ok); err != nil {
+		t.Fatalf("[GRPC] expected fail open, got %v", err)
+	}
+	_, err := towergrpc.UnaryServerInterceptor(c, towergrpc.FailClosed())(context.Background(), nil, info, ok)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("[GRPC] expected Unavailable when failing closed, got %v", err)
+	}
+}